@@ -14,15 +14,32 @@ import (
 )
 
 type App struct {
-	journal   *Journal
-	focus     int
-	date      time.Time
-	dayPicker *DayPickerState
-	tagsList  *TagsState
-	preview   *c.TextState
-	pwdInput  *c.InputState
-	pwdError  error
-	logs      *c.TextState
+	journal      *Journal
+	autoLock     time.Duration
+	lastActivity time.Time
+	focus        int
+	date         time.Time
+	dayPicker    *DayPickerState
+	tagsList     *TagsState
+	search       *SearchState
+	preview      *c.TextState
+	previewDate  time.Time
+	pwdInput     *c.InputState
+	pwdError     error
+	pwdSources   []PasswordSource
+	isRecovery   bool
+	mountIssue   *MountIssue
+	mountFix     bool
+	setup        *SetupState
+	pwdDialog    *PasswordDialogState
+	masterKey    string
+	logs         *c.TextState
+	// kept while locked if it has unsaved changes
+	inlineEdit     *c.TextAreaState
+	inlineSession  *EditSession
+	quitRefused    time.Time
+	conflicts      []*ConflictState
+	templatePicker *TemplatePickerState
 }
 
 const (
@@ -30,30 +47,46 @@ const (
 	FocusTags
 	FocusPreview
 	FocusLogs
+	FocusSearch
 )
 
-func CreateApp(journal *Journal) *App {
+const numPanels = 5
+
+func CreateApp(journal *Journal, autoLock time.Duration) *App {
 	app := &App{
 		journal:   journal,
+		autoLock:  autoLock,
 		focus:     FocusDayPicker,
 		date:      time.Now(),
 		dayPicker: &DayPickerState{gotoInput: &c.InputState{}},
 		preview:   &c.TextState{},
 		tagsList: &TagsState{
-			tags:    []string{},
+			tags:    []TagInfo{},
 			refs:    []time.Time{},
-			tagList: &c.ListState[string]{},
+			tagList: c.NewTreeState[TagInfo](),
 			refList: &c.ListState[time.Time]{},
+			rename:  &TagRenameState{input: &c.InputState{}},
+			filter:  &c.InputState{},
+
+			relatedList: &c.ListState[TagInfo]{},
+		},
+		search:    NewSearchState(),
+		logs:      &c.TextState{},
+		pwdInput:  &c.InputState{},
+		pwdDialog: NewPasswordDialogState(),
+		setup: &SetupState{
+			pwdInput:     &c.InputState{},
+			confirmInput: &c.InputState{},
 		},
-		logs:     &c.TextState{},
-		pwdInput: &c.InputState{},
 	}
 	app.preview.Lines = []string{}
 	return app
 }
 
 func (app *App) showEntryPreview(date time.Time) {
-	if app.journal.isMounted {
+	app.previewDate = date
+	app.preview.Highlights = []string{}
+	if app.journal.IsMounted() {
 		entry, has, err := app.journal.GetEntry(date)
 		switch {
 		case err != nil:
@@ -68,23 +101,290 @@ func (app *App) showEntryPreview(date time.Time) {
 	}
 }
 
+func (app *App) showSearchResult(result SearchResult) {
+	app.showEntryPreview(result.Date)
+	app.preview.Highlights = app.search.highlights()
+	app.preview.Scroll = c.Pos{X: 0, Y: max(0, result.Line-2)}
+}
+
+func (app *App) pickTemplate(date time.Time, then func(template string)) {
+	has, err := app.journal.HasEntry(date)
+	if err != nil {
+		log.Println("failed to check for entry; ", err)
+		return
+	}
+	if has || app.journal.IsReadOnly() {
+		then("")
+		return
+	}
+
+	templates, err := app.journal.Templates(date)
+	if err != nil {
+		log.Println("failed to get templates; ", err)
+	}
+	if len(templates) < 2 {
+		then("")
+		return
+	}
+
+	app.templatePicker = &TemplatePickerState{
+		date:      date,
+		templates: templates,
+		list:      &c.ListState[string]{},
+		onPick:    then,
+	}
+}
+
+func (app *App) editEntry(date time.Time, altMode bool) {
+	if app.journal.IsReadOnly() {
+		log.Println("cannot edit entry,", ErrReadOnly)
+		return
+	}
+	if !app.journal.CanEditExternally() {
+		app.editInline(date)
+		return
+	}
+	if app.journal.editor == nil {
+		log.Println("cannot edit entry without an editor")
+		return
+	}
+
+	mode := app.journal.editor.Mode
+	if altMode {
+		mode = app.journal.editor.AltMode
+	}
+	app.pickTemplate(date, func(template string) {
+		if len(template) > 0 {
+			path, err := app.journal.CreateEntry(date, template)
+			if err != nil {
+				log.Println("failed to create entry; ", err)
+				return
+			}
+			log.Printf("created new entry: %s", path)
+		}
+
+		err := app.journal.EditEntry(date, mode)
+		if err != nil {
+			log.Print(err)
+		}
+	})
+}
+
+func (app *App) editInline(date time.Time) {
+	if app.journal.IsReadOnly() {
+		log.Println("cannot edit entry,", ErrReadOnly)
+		return
+	}
+
+	app.pickTemplate(date, func(template string) {
+		content, has, err := app.journal.GetEntry(date)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if !has {
+			content, err = app.journal.NewEntryContent(date, template)
+			if err != nil {
+				log.Println("failed to create entry; ", err)
+				return
+			}
+		}
+
+		app.inlineEdit = c.NewTextAreaState(content)
+		app.inlineSession = app.journal.BeginEdit(date)
+		app.focus = FocusPreview
+
+		// start at the end, where new text is usually added
+		last := len(app.inlineEdit.Lines) - 1
+		app.inlineEdit.Cursor = c.Pos{X: len(app.inlineEdit.Lines[last]), Y: last}
+	})
+}
+
+func (app *App) saveInline() error {
+	if app.inlineEdit == nil || !app.inlineEdit.Modified {
+		return nil
+	}
+	date := app.inlineSession.Date
+	err := app.journal.SaveEdit(app.inlineSession, app.inlineEdit.Text())
+	if err != nil {
+		log.Println("failed to save entry; ", err)
+		return err
+	}
+	app.inlineEdit.MarkSaved()
+	log.Printf("saved entry: %s", app.journal.EntryPath(date))
+	return nil
+}
+
+func (app *App) closeInline() {
+	if err := app.saveInline(); err != nil {
+		return
+	}
+	app.journal.EndEdit(app.inlineSession)
+	app.inlineEdit = nil
+	app.showEntryPreview(app.inlineSession.Date)
+}
+
 func (app *App) handlePasswordInput() {
 	password := app.pwdInput.Value
 	app.pwdInput.Value = ""
 	app.pwdInput.Cursor = 0
-	app.pwdError = nil
+	app.pwdError = app.unlock(password)
+}
 
-	if !app.journal.isMounted {
-		app.pwdError = app.journal.Mount(password)
-		if app.pwdError != nil {
-			log.Println("failed to unlock journal; ", app.pwdError)
-			return
-		}
+func (app *App) unlock(password string) error {
+	if app.journal.IsMounted() {
+		return nil
+	}
+
+	err := app.journal.Mount(password)
+	if err != nil {
+		log.Println("failed to unlock journal; ", err)
+		return err
+	}
+
+	app.handleUnlock()
+	return nil
+}
 
-		log.Println("Unlocked journal")
+func (app *App) unlockWithSources() {
+	if len(app.pwdSources) == 0 || app.journal.IsMounted() || app.journal.NeedsSetup() {
+		return
+	}
+	err := tryPasswordSources(app.pwdSources, func(password string) error {
+		app.pwdError = app.unlock(password)
+		return app.pwdError
+	})
+	if err != nil {
+		log.Println("failed to unlock journal with the password sources; ", err)
+	}
+}
+
+func (app *App) handleMasterKeyInput() {
+	masterKey := app.pwdInput.Value
+	app.pwdInput.Value = ""
+	app.pwdInput.Cursor = 0
+
+	app.pwdError = app.journal.MountMasterKey(masterKey)
+	if app.pwdError != nil {
+		log.Println("failed to unlock journal with the master key; ", app.pwdError)
+		return
+	}
+
+	app.isRecovery = false
+	app.handleUnlock()
 
-		app.tagsList.update(app.journal)
-		app.showEntryPreview(app.date)
+	// the password was probably forgotten, so offer to set a new one
+	masterKey, _ = normalizeMasterKey(masterKey)
+	app.pwdDialog.openReset(masterKey)
+}
+
+func (app *App) handleMountIssue(accepted bool) {
+	issue := app.mountIssue
+	app.mountIssue = nil
+	if !accepted {
+		return
+	}
+
+	err := issue.Fix()
+	if err != nil {
+		log.Println("failed to fix mount point; ", err)
+		app.pwdError = err
+		return
+	}
+
+	// the password sources were not tried while the journal could not be
+	// mounted
+	app.unlockWithSources()
+}
+
+func (app *App) handleUnlock() {
+	log.Println("Unlocked journal")
+	app.touch()
+
+	if app.inlineEdit != nil {
+		app.journal.ResumeEdit(app.inlineSession)
+		app.focus = FocusPreview
+		log.Println("restored the unsaved changes to the entry, press Ctrl-S to save them")
+	}
+
+	app.tagsList.update(app.journal)
+	app.showEntryPreview(app.date)
+}
+
+func (app *App) lock() {
+	app.saveInline()
+	err := app.journal.Unmount()
+	if err != nil {
+		log.Println("failed to lock journal; ", err)
+	}
+}
+
+// Also called when gocryptfs unmounts the journal on its own.
+func (app *App) handleLock() {
+	app.focus = FocusDayPicker
+	app.dayPicker = &DayPickerState{gotoInput: &c.InputState{}}
+	app.pwdDialog.close()
+	app.conflicts = []*ConflictState{}
+	app.templatePicker = nil
+	app.tagsList.isShowRefs = false
+	app.tagsList.refs = []time.Time{}
+	app.tagsList.related = []TagInfo{}
+	app.tagsList.isRelatedFocus = false
+	app.tagsList.rename = &TagRenameState{input: &c.InputState{}}
+	app.tagsList.filter = &c.InputState{}
+	app.tagsList.isFiltering = false
+	app.tagsList.update(app.journal)
+	app.search = NewSearchState()
+	app.showEntryPreview(app.date)
+
+	// gocryptfs can unmount the journal without the app saving first, e.g.
+	// after being idle, so unsaved changes are kept until it is unlocked
+	if app.inlineEdit != nil && app.inlineEdit.Modified {
+		log.Println("the entry was locked before its changes were saved, unlock the journal to save them")
+	} else {
+		app.inlineEdit = nil
+	}
+
+	log.Println("Locked journal")
+}
+
+func (app *App) touch() {
+	app.lastActivity = time.Now()
+
+	// typing in the inline editor does not touch any files, which gocryptfs
+	// would take as being idle
+	if app.inlineEdit != nil && app.journal.IsMounted() {
+		app.journal.HasEntry(app.inlineSession.Date)
+	}
+}
+
+// Quitting again within a few seconds quits without saving.
+func (app *App) canQuit() bool {
+	if err := app.saveInline(); err == nil || time.Since(app.quitRefused) < 3*time.Second {
+		return true
+	}
+	app.quitRefused = time.Now()
+	log.Println("the entry could not be saved, quit again to discard the changes")
+	return false
+}
+
+// Returns a negative duration if the inactivity lock is disabled.
+func (app *App) timeUntilLock() time.Duration {
+	if app.autoLock <= 0 || !app.journal.IsMounted() {
+		return -1
+	}
+	return max(0, app.autoLock-time.Since(app.lastActivity))
+}
+
+func (app *App) checkInactivity() {
+	// editors outside of the app get used without any key presses in it, and
+	// locking would unmount the journal under them
+	if app.journal.IsEditing(app.inlineSession) {
+		app.lastActivity = time.Now()
+	}
+	if app.timeUntilLock() == 0 {
+		log.Printf("locking journal after %s of inactivity", app.autoLock)
+		app.lock()
 	}
 }
 
@@ -100,7 +400,7 @@ func DrawApp(r c.Renderer, app *App) c.EventHandler {
 	width, height := r.Size()
 
 	var minSize c.Size
-	if app.journal.isMounted {
+	if app.journal.IsMounted() {
 		minSize = minSizeUnlocked
 	} else {
 		minSize = minSizeLocked
@@ -117,25 +417,46 @@ func DrawApp(r c.Renderer, app *App) c.EventHandler {
 		return nil
 	}
 
-	if !app.journal.isMounted {
+	if !app.journal.IsMounted() && app.journal.NeedsSetup() {
+		return DrawSetup(r, app)
+	}
+
+	if app.journal.IsMounted() && len(app.masterKey) > 0 {
+		return DrawMasterKey(r, app)
+	}
+
+	if !app.journal.IsMounted() {
 		style := theme.BordersFocus()
 		if app.pwdError != nil {
 			style = style.Foreground(t.ColorOrangeRed)
 		}
 
-		rect := c.CenterRect(r.GetRegion(), min(width, 40), 3)
+		title, mask, boxWidth := "Password", "*", 40
+		if app.isRecovery {
+			title, mask, boxWidth = "Master key", "", 75
+		}
+
+		rect := c.CenterRect(r.GetRegion(), min(width, boxWidth), 3)
 		handler := c.Box(r.SubRegion(rect), c.BoxProps{
-			Title:   "Password",
+			Title:   title,
 			Borders: c.BordersRound,
 			Style:   style,
 			Children: func(r c.Renderer) c.EventHandler {
 				return c.Input(r, c.InputProps{
 					State: app.pwdInput,
-					Mask:  "*",
+					Mask:  mask,
 				})
 			},
 		})
 
+		if app.journal.CanRecover() {
+			hint := "Forgot password? <Ctrl-R>"
+			if app.isRecovery {
+				hint = "Use password: <Ctrl-R>"
+			}
+			r.PutStrStyled(max(0, (width-len(hint))/2), height-1, hint, theme.Help())
+		}
+
 		logoRegion := r.SubRegion(c.Rect{
 			Pos:  c.Pos{X: (width - LogoSize.W) / 2, Y: rect.Y - LogoSize.H},
 			Size: LogoSize,
@@ -152,14 +473,40 @@ func DrawApp(r c.Renderer, app *App) c.EventHandler {
 			})
 		}
 
+		if app.mountIssue != nil {
+			return c.Confirm(c.CenteredRegion(r, min(width, 50), 3), true, c.ConfirmProps{
+				Message:  app.mountIssue.Message,
+				Yes:      "Yes",
+				No:       "No",
+				Borders:  c.BordersRound,
+				Style:    theme.Borders(true, theme.Dialog()),
+				Value:    app.mountFix,
+				OnSelect: func(value bool) { app.mountFix = value },
+				OnChoice: app.handleMountIssue,
+			})
+		}
+
 		return func(ev t.Event) bool {
 			if handler != nil && handler(ev) {
 				return true
 			}
 			switch ev := ev.(type) {
 			case *t.EventKey:
-				if ev.Key() == t.KeyEnter {
-					app.handlePasswordInput()
+				switch ev.Key() {
+				case t.KeyEnter:
+					if app.isRecovery {
+						app.handleMasterKeyInput()
+					} else {
+						app.handlePasswordInput()
+					}
+					return true
+				case t.KeyCtrlR:
+					if app.journal.CanRecover() {
+						app.isRecovery = !app.isRecovery
+						app.pwdInput.Value = ""
+						app.pwdInput.Cursor = 0
+						app.pwdError = nil
+					}
 					return true
 				}
 			}
@@ -176,11 +523,13 @@ func DrawApp(r c.Renderer, app *App) c.EventHandler {
 
 		mainRegion, helpRegion := r.SplitVertical(height - 1)
 		topRegion, logsRegion := mainRegion.SplitVertical(height - logsHeight)
-		leftRegion, previewRegion := topRegion.SplitHorizontal(calendarWidth)
+		leftRegion, rightRegion := topRegion.SplitHorizontal(calendarWidth)
 		calRegion, tagsRegion := leftRegion.SplitVertical(calendarHeight)
+		_, rightHeight := rightRegion.Size()
+		searchRegion, previewRegion := rightRegion.SplitVertical(max(6, rightHeight/3))
 
 		logsHandler := c.Box(logsRegion, c.BoxProps{
-			Title:   fmt.Sprintf("[4]─Logs (%d)", len(app.logs.Lines)),
+			Title:   panelTitle(app.journal, fmt.Sprintf("[4]─Logs (%d)", len(app.logs.Lines))),
 			Borders: c.BordersRound,
 			Style:   theme.Borders(isLogsFocused),
 			Children: func(r c.Renderer) c.EventHandler {
@@ -194,17 +543,41 @@ func DrawApp(r c.Renderer, app *App) c.EventHandler {
 			hasFocus:      app.focus == FocusTags,
 			onSelectRef:   app.showEntryPreview,
 			onDeselectRef: func() { app.showEntryPreview(app.date) },
+			onEdit:        app.editEntry,
 		})
 
+		previewTitle := "[3]─Preview"
+		if app.inlineEdit != nil {
+			previewTitle = "[3]─Editing " + app.inlineSession.Date.Format("02 Jan 2006")
+			if app.inlineEdit.Modified {
+				previewTitle += " [+]"
+			}
+		}
 		previewHandler := c.Box(previewRegion, c.BoxProps{
-			Title:   "[3]─Preview",
+			Title:   panelTitle(app.journal, previewTitle),
 			Borders: c.BordersRound,
 			Style:   theme.Borders(app.focus == FocusPreview),
 			Children: func(r c.Renderer) c.EventHandler {
+				if app.inlineEdit != nil {
+					return c.TextArea(r, c.TextAreaProps{
+						State:      app.inlineEdit,
+						HideCursor: app.focus != FocusPreview,
+						OnSave:     func(string) { app.saveInline() },
+						OnExit:     func(string) { app.closeInline() },
+					})
+				}
 				return c.Text(r, c.TextProps{State: app.preview})
 			},
 		})
 
+		searchHandler := SearchPanel(searchRegion, SearchProps{
+			state:    app.search,
+			journal:  app.journal,
+			hasFocus: app.focus == FocusSearch,
+			onSelect: app.showSearchResult,
+			onEdit:   app.editEntry,
+		})
+
 		dayPickerHandler := DayPicker(calRegion, DayPickerProps{
 			state:    app.dayPicker,
 			journal:  app.journal,
@@ -214,11 +587,56 @@ func DrawApp(r c.Renderer, app *App) c.EventHandler {
 				app.date = newValue
 				app.showEntryPreview(newValue)
 			},
+			onEdit: app.editEntry,
 		})
 
-		DrawHelp(helpRegion, app.focus)
+		DrawHelp(helpRegion, app.focus, app.inlineEdit != nil, app.timeUntilLock())
+
+		if len(app.conflicts) > 0 {
+			return ConflictView(r, ConflictProps{
+				state:   app.conflicts[0],
+				journal: app.journal,
+				onClose: func() { app.conflicts = app.conflicts[1:] },
+			})
+		}
+
+		if app.templatePicker != nil {
+			return TemplatePicker(r, TemplatePickerProps{
+				state:   app.templatePicker,
+				onClose: func() { app.templatePicker = nil },
+			})
+		}
+
+		if rename := app.tagsList.rename; rename.showPrompt || rename.showConfirm {
+			return TagRenameDialog(r, TagsProps{state: app.tagsList, journal: app.journal})
+		}
+
+		if app.pwdDialog.isOpen {
+			return PasswordDialog(r, PasswordDialogProps{
+				state: app.pwdDialog,
+				onSubmit: func(current, new string) error {
+					var err error
+					if masterKey := app.pwdDialog.masterKey; len(masterKey) > 0 {
+						err = app.journal.ResetPassword(masterKey, new)
+					} else {
+						err = app.journal.ChangePassword(current, new)
+					}
+					if err != nil {
+						log.Println("failed to change password; ", err)
+						return err
+					}
+					log.Println("Changed journal password")
+					return nil
+				},
+			})
+		}
 
 		return func(ev t.Event) bool {
+			// the editor gets every key, until leaving it with Esc
+			if app.inlineEdit != nil {
+				return previewHandler(ev)
+			}
+
 			switch app.focus {
 			case FocusDayPicker:
 				if dayPickerHandler(ev) {
@@ -236,6 +654,10 @@ func DrawApp(r c.Renderer, app *App) c.EventHandler {
 				if logsHandler(ev) {
 					return true
 				}
+			case FocusSearch:
+				if searchHandler(ev) {
+					return true
+				}
 			}
 
 			switch ev := ev.(type) {
@@ -251,6 +673,8 @@ func DrawApp(r c.Renderer, app *App) c.EventHandler {
 						app.focus = FocusPreview
 					case '4':
 						app.focus = FocusLogs
+					case '5':
+						app.focus = FocusSearch
 					case 'c':
 						if app.focus == FocusLogs {
 							app.logs.Lines = []string{}
@@ -258,11 +682,24 @@ func DrawApp(r c.Renderer, app *App) c.EventHandler {
 					case 't':
 						app.date = time.Now()
 						return true
+					case 'i':
+						app.editInline(app.previewDate)
+						return true
+					case 'L':
+						app.lock()
+						return true
+					case 'P':
+						if app.journal.IsReadOnly() {
+							log.Println("cannot change the password,", ErrReadOnly)
+						} else if app.journal.CanChangePassword() {
+							app.pwdDialog.open()
+						}
+						return true
 					}
 				case t.KeyTab:
-					app.focus = (app.focus + 1) % 4
+					app.focus = (app.focus + 1) % numPanels
 				case t.KeyBacktab:
-					app.focus = (app.focus + 3) % 4
+					app.focus = (app.focus + numPanels - 1) % numPanels
 				case t.KeyCtrlU, t.KeyPgUp:
 					app.preview.Scroll = app.preview.Scroll.Add(0, -10)
 					return true
@@ -277,20 +714,40 @@ func DrawApp(r c.Renderer, app *App) c.EventHandler {
 	}
 }
 
-func DrawHelp(r c.Renderer, focus int) {
+const lockWarning = time.Minute
+
+func DrawHelp(r c.Renderer, focus int, isEditing bool, lockIn time.Duration) {
 	text := ""
-	switch focus {
-	case FocusDayPicker:
-		text = "Select day: ⬍/⬌ | Edit: <ENTER> or e | Delete: d | Today: t | Go to specific day: g | Exit: q"
-	case FocusTags:
-		text = "Select: ⬍ | View entries: <ENTER>"
-	case FocusPreview:
-		text = "Scroll: ⬍"
-	case FocusLogs:
+	switch {
+	case isEditing:
+		text = "Select: <SHIFT>+⬍/⬌ | Select all: <CTRL-A> | Undo/redo: <CTRL-Z>/<CTRL-Y> | Save: <CTRL-S> | Save and close: <ESC>"
+	case focus == FocusDayPicker:
+		text = "Select day: ⬍/⬌ | Edit: <ENTER> or e | Delete: d | Today: t | Go to specific day: g | Password: P | Lock: L | Exit: q"
+	case focus == FocusTags:
+		text = "Select: ⬍ | Expand/collapse: ⬌ | View entries: <ENTER> | Filter: / | Sort by name, count or last used: s | Rename: R"
+	case focus == FocusPreview:
+		text = "Scroll: ⬍ | Edit here: i"
+	case focus == FocusLogs:
 		text = "Select: ⬍ | Clear: c"
+	case focus == FocusSearch:
+		text = "Search: <ENTER> (e.g. @work -@travel after:2025-01-01 \"standup\") | Select result: ⬍ | Edit: <ENTER> | Back to query: <ESC> or /"
 	}
 
 	r.PutStrStyled(0, 0, text, theme.Help())
+
+	if lockIn >= 0 && lockIn <= lockWarning {
+		secs := int(lockIn.Round(time.Second).Seconds())
+		countdown := fmt.Sprintf(" Locking in %d:%02d ", secs/60, secs%60)
+		width, _ := r.Size()
+		r.PutStrStyled(width-len(countdown), 0, countdown, theme.HelpWarning())
+	}
+}
+
+func panelTitle(journal *Journal, title string) string {
+	if journal.IsReadOnly() {
+		return title + "─[READ-ONLY]"
+	}
+	return title
 }
 
 type AppLogWriter struct{ app *App }
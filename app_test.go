@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	c "github.com/mecha/journal/components"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+// Renders the app on a simulated screen and returns the screen's text.
+func renderApp(tt *testing.T, app *App) (string, c.EventHandler) {
+	tt.Helper()
+	screen := t.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		tt.Fatal(err)
+	}
+	tt.Cleanup(screen.Fini)
+	screen.SetSize(120, 40)
+
+	handler := DrawApp(c.NewScreenRenderer(screen), app)
+	screen.Show()
+
+	cells, width, _ := screen.GetContents()
+	var text strings.Builder
+	for i, cell := range cells {
+		if i > 0 && i%width == 0 {
+			text.WriteString("\n")
+		}
+		text.WriteString(string(cell.Runes))
+	}
+	return text.String(), handler
+}
+
+func TestAppShowsEntry(tt *testing.T) {
+	journal := newTestJournal(tt, map[string]string{
+		"2025/01/15.md": "# Wed - 15 Jan 2025\n\nwent climbing @gym",
+	}, false)
+	app := CreateApp(journal, 0)
+	app.date = day(2025, 1, 15)
+	app.handleUnlock()
+
+	screen, _ := renderApp(tt, app)
+	for _, want := range []string{"January 2025", "went climbing @gym", "@gym"} {
+		if !strings.Contains(screen, want) {
+			tt.Errorf("screen does not contain %q:\n%s", want, screen)
+		}
+	}
+}
+
+func TestAppLock(tt *testing.T) {
+	journal := newTestJournal(tt, map[string]string{"2025/01/15.md": "@gym"}, false)
+	app := CreateApp(journal, 0)
+	journal.onUnmount = app.handleLock
+	app.handleUnlock()
+
+	_, handler := renderApp(tt, app)
+	handler(t.NewEventKey(t.KeyRune, 'L', t.ModNone))
+
+	if journal.IsMounted() {
+		tt.Fatal("journal is still mounted after pressing L")
+	}
+	if len(app.tagsList.tags) > 0 {
+		tt.Errorf("tags are still shown after locking: %v", app.tagsList.tags)
+	}
+	if screen, _ := renderApp(tt, app); strings.Contains(screen, "@gym") {
+		tt.Errorf("screen still shows the journal after locking:\n%s", screen)
+	}
+}
+
+func TestAppRelatedTagsEsc(tt *testing.T) {
+	journal := newTestJournal(tt, map[string]string{
+		"2025/01/01.md": "@work @gym",
+		"2025/01/02.md": "@work",
+	}, false)
+	app := CreateApp(journal, 0)
+	app.handleUnlock()
+	app.focus = FocusTags
+	app.tagsList.showRefs(journal, "@work")
+
+	press := func(key t.Key, r rune) {
+		_, handler := renderApp(tt, app)
+		handler(t.NewEventKey(key, r, t.ModNone))
+	}
+	press(t.KeyRune, 'l')
+	press(t.KeyEnter, 0)
+	if app.tagsList.narrowTag != "@gym" || len(app.tagsList.refs) != 1 {
+		tt.Fatalf("Enter narrowed to %q with refs %v", app.tagsList.narrowTag, app.tagsList.refs)
+	}
+
+	press(t.KeyEsc, 0)
+	if app.tagsList.isRelatedFocus {
+		tt.Error("related tags still have focus after Esc")
+	}
+	if app.tagsList.narrowTag != "" || len(app.tagsList.refs) != 2 {
+		tt.Errorf("Esc kept the narrowing to %q with refs %v", app.tagsList.narrowTag, app.tagsList.refs)
+	}
+	if !app.tagsList.isShowRefs {
+		tt.Error("Esc in the related tags also closed the references")
+	}
+}
+
+// Like when gocryptfs unmounts the journal after being idle, without the app
+// saving the entry that is edited inline first.
+func TestAppKeepsInlineEditWhenUnmounted(tt *testing.T) {
+	journal := newTestJournal(tt, map[string]string{"2025/01/15.md": "# Jan\n"}, false)
+	app := CreateApp(journal, 0)
+	journal.onUnmount = app.handleLock
+	app.handleUnlock()
+
+	app.editInline(day(2025, 1, 15))
+	_, handler := renderApp(tt, app)
+	handler(t.NewEventKey(t.KeyRune, 'x', t.ModNone))
+
+	journal.store.Unmount()
+	if app.inlineEdit == nil || !app.inlineEdit.Modified {
+		tt.Fatal("unsaved changes were dropped when the journal got locked")
+	}
+	if screen, _ := renderApp(tt, app); strings.Contains(screen, "# Jan") {
+		tt.Errorf("screen shows the entry while locked:\n%s", screen)
+	}
+
+	if err := journal.Mount(""); err != nil {
+		tt.Fatal(err)
+	}
+	app.handleUnlock()
+	if app.focus != FocusPreview {
+		tt.Error("the inline editor was not focused after unlocking")
+	}
+	if err := app.saveInline(); err != nil {
+		tt.Fatal(err)
+	}
+	if content, _, _ := journal.GetEntry(day(2025, 1, 15)); content != "# Jan\nx" {
+		tt.Errorf("saved entry = %q", content)
+	}
+}
+
+func TestAppSavesInlineEditBeforeQuitting(tt *testing.T) {
+	journal := newTestJournal(tt, map[string]string{"2025/01/15.md": "# Jan\n"}, false)
+	app := CreateApp(journal, 0)
+	app.handleUnlock()
+
+	app.editInline(day(2025, 1, 15))
+	_, handler := renderApp(tt, app)
+	handler(t.NewEventKey(t.KeyRune, 'x', t.ModNone))
+
+	if !app.canQuit() {
+		tt.Fatal("quitting was refused")
+	}
+	if content, _, _ := journal.GetEntry(day(2025, 1, 15)); content != "# Jan\nx" {
+		tt.Errorf("entry after quitting = %q", content)
+	}
+
+	// an entry that cannot be saved needs a second try to quit
+	handler(t.NewEventKey(t.KeyRune, 'y', t.ModNone))
+	journal.Unmount()
+	if app.canQuit() {
+		tt.Error("quit without saving the entry")
+	}
+	if !app.canQuit() {
+		tt.Error("quitting again was refused")
+	}
+}
+
+func TestAppInactivityLockWaitsForEditors(tt *testing.T) {
+	journal := newTestJournal(tt, map[string]string{"2025/01/15.md": "# Jan\n"}, false)
+	app := CreateApp(journal, time.Minute)
+	app.handleUnlock()
+
+	// like an editor in another tmux window, which the app does not wait for
+	session := journal.BeginEdit(day(2025, 1, 15))
+	app.lastActivity = time.Now().Add(-time.Hour)
+	app.checkInactivity()
+	if !journal.IsMounted() {
+		tt.Fatal("journal was locked while an entry was open in an editor")
+	}
+
+	journal.EndEdit(session)
+	app.editInline(day(2025, 1, 16))
+	app.lastActivity = time.Now().Add(-time.Hour)
+	app.checkInactivity()
+	if journal.IsMounted() {
+		tt.Error("journal was not locked after being inactive")
+	}
+}
+
+func TestAppReadOnly(tt *testing.T) {
+	journal := newTestJournal(tt, map[string]string{"2025/01/15.md": "# Jan\nsaved\n"}, true)
+	app := CreateApp(journal, 0)
+	app.date = day(2025, 1, 15)
+	app.handleUnlock()
+
+	// the calendar, tags, search, preview and logs panels
+	screen, _ := renderApp(tt, app)
+	if count := strings.Count(screen, "READ-ONLY"); count != 5 {
+		tt.Errorf("READ-ONLY is shown in %d panel titles, want 5:\n%s", count, screen)
+	}
+
+	app.tagsList.showRefs(journal, "@none")
+	if screen, _ := renderApp(tt, app); strings.Count(screen, "READ-ONLY") != 5 {
+		tt.Errorf("READ-ONLY is not shown while showing the entries of a tag:\n%s", screen)
+	}
+
+	app.conflicts = []*ConflictState{{conflict: Conflict{day(2025, 1, 15), "# Jan\noverwritten\n", "# Jan\nsaved\n"}}}
+	_, handler := renderApp(tt, app)
+	handler(t.NewEventKey(t.KeyRune, 'r', t.ModNone))
+	if content, _, _ := journal.GetEntry(day(2025, 1, 15)); content != "# Jan\nsaved\n" {
+		tt.Errorf("the overwritten version was restored in read-only mode: %q", content)
+	}
+	if len(app.conflicts) != 1 {
+		tt.Error("the conflict was closed without restoring it")
+	}
+}
+
+func TestAppTriesPasswordSourcesAfterMountIssue(tt *testing.T) {
+	vault, _ := newTestVault(tt, "secret")
+	journal := NewJournal(vault, false)
+	defer journal.Unmount()
+	app := CreateApp(journal, 0)
+	app.pwdSources = []PasswordSource{&ExtPassSource{"echo secret"}}
+
+	app.mountIssue = &MountIssue{Fix: func() error { return errors.New("still broken") }}
+	app.handleMountIssue(true)
+	if journal.IsMounted() {
+		tt.Fatal("journal was unlocked although the mount issue was not fixed")
+	}
+
+	app.mountIssue = &MountIssue{Fix: func() error { return nil }}
+	app.handleMountIssue(true)
+	if !journal.IsMounted() {
+		tt.Error("password sources were not tried after fixing the mount issue")
+	}
+}
+
+// Entries are opened the same way from every panel, which checks for the
+// editor before using it.
+func TestAppEditWithoutEditor(tt *testing.T) {
+	journal := newTestJournal(tt, map[string]string{"2025/01/15.md": "@gym"}, false)
+	app := CreateApp(journal, 0)
+	log.SetOutput(&AppLogWriter{app})
+	defer log.SetOutput(os.Stderr)
+	app.handleUnlock()
+	app.focus = FocusSearch
+	app.search.input.Value = "@gym"
+	app.search.search(journal)
+	app.search.isResultsFocus = true
+
+	_, handler := renderApp(tt, app)
+	handler(t.NewEventKey(t.KeyEnter, 0, t.ModNone))
+	if !strings.Contains(strings.Join(app.logs.Lines, "\n"), "without an editor") {
+		tt.Errorf("editing without an editor was not refused: %v", app.logs.Lines)
+	}
+	app.logs.Lines = []string{}
+	app.focus = FocusTags
+	app.tagsList.showRefs(journal, "@gym")
+	_, handler = renderApp(tt, app)
+	handler(t.NewEventKey(t.KeyEnter, 0, t.ModNone))
+	if !strings.Contains(strings.Join(app.logs.Lines, "\n"), "without an editor") {
+		tt.Errorf("editing an entry of a tag without an editor was not refused: %v", app.logs.Lines)
+	}
+}
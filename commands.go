@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+func runInit(store Store) error {
+	initStore, canInit := store.(InitStore)
+	if !canInit {
+		return errors.New("this kind of journal does not need to be set up")
+	}
+	if initStore.IsInitialized() {
+		return errors.New("there is already a journal in " + Flags.path)
+	}
+
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+	if len(password) == 0 {
+		return ErrEmptyPassword
+	}
+
+	confirm, err := readPassword("Confirm password: ")
+	if err != nil {
+		return err
+	}
+	if password != confirm {
+		return ErrPasswordMismatch
+	}
+
+	masterKey, err := initStore.Init(password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created a new journal in %s\n\n", Flags.path)
+	fmt.Printf("Your master key is:\n\n    %s\n\n", masterKey)
+	fmt.Println("Write it down and keep it somewhere safe. It is the only way to recover")
+	fmt.Println("the journal if you forget the password.")
+
+	return nil
+}
+
+func runQuery(store Store) error {
+	query, err := ParseQuery(Flags.query)
+	if err != nil {
+		return err
+	}
+	if query == nil {
+		return errors.New("the query is empty")
+	}
+
+	journal := NewJournal(store, true)
+	if journal.NeedsSetup() {
+		return ErrNotInitialized
+	}
+
+	if err := commandMount(journal); err != nil {
+		return err
+	}
+	defer journal.Unmount()
+
+	dates, err := journal.Query(query)
+	if err != nil {
+		return err
+	}
+	for _, date := range dates {
+		fmt.Println(date.Format(queryDateFormat))
+	}
+
+	return nil
+}
+
+func commandMount(journal *Journal) error {
+	if Flags.store == StorePlain {
+		return journal.Mount("")
+	}
+
+	if sources := passwordSources(); len(sources) > 0 {
+		err := tryPasswordSources(sources, journal.Mount)
+		if err == nil {
+			return nil
+		}
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+	return journal.Mount(password)
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// Reads a line from STDIN if it is not a terminal.
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := stdinReader.ReadString('\n')
+		// the last line may not end with a newline
+		if err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		return strings.TrimSuffix(line, "\n"), err
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	return string(password), err
+}
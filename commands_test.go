@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/term"
+)
+
+func TestReadPasswordFromPipe(t *testing.T) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		t.Skip("STDIN is a terminal")
+	}
+	defer func(reader *bufio.Reader) { stdinReader = reader }(stdinReader)
+
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"secret\n", []string{"secret"}},
+		{"secret", []string{"secret"}},
+		{"first\nsecond", []string{"first", "second"}},
+	}
+	for _, test := range tests {
+		stdinReader = bufio.NewReader(strings.NewReader(test.input))
+		for _, want := range test.want {
+			got, err := readPassword("")
+			if err != nil || got != want {
+				t.Errorf("readPassword() with %q = %q, %v, want %q", test.input, got, err, want)
+			}
+		}
+		if _, err := readPassword(""); err != io.EOF {
+			t.Errorf("readPassword() after the input of %q = %v, want EOF", test.input, err)
+		}
+	}
+}
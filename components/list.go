@@ -1,6 +1,7 @@
 package components
 
 import (
+	"strings"
 	"unicode/utf8"
 
 	"github.com/mecha/journal/theme"
@@ -16,6 +17,10 @@ type ListProps[Item any] struct {
 	RenderFunc   ListRenderFunc[Item]
 	OnEnter      ListItemFunc[Item]
 	OnSelect     ListItemFunc[Item]
+	// the cursor and the callbacks' indexes refer to the filtered items
+	Filter string
+	// defaults to the rendered item
+	FilterText ListRenderFunc[Item]
 }
 
 type ListState[Item any] struct {
@@ -28,12 +33,37 @@ type ListState[Item any] struct {
 type ListRenderFunc[Item any] func(item Item) string
 type ListItemFunc[Item any] func(i int, item Item)
 
+func FilterItems[Item any](items []Item, filter string, text ListRenderFunc[Item]) ([]Item, [][]int) {
+	if len(filter) == 0 {
+		return items, make([][]int, len(items))
+	}
+
+	filtered := []Item{}
+	matches := [][]int{}
+	for _, item := range items {
+		if positions := utils.FuzzyMatch(text(item), filter); positions != nil {
+			filtered = append(filtered, item)
+			matches = append(matches, positions)
+		}
+	}
+	return filtered, matches
+}
+
 func List[Item any](r Renderer, props ListProps[Item]) EventHandler {
 	width, height := r.Size()
 	state := props.State
 	state.LastSize = Size{width, height}
 
-	rendered := make([]string, 0, min(height, len(props.Items)))
+	filterText := props.FilterText
+	if filterText == nil {
+		filterText = props.RenderFunc
+	}
+	items, matches := FilterItems(props.Items, props.Filter, filterText)
+	props.Items = items
+	if len(props.Filter) > 0 {
+		state.Cursor = max(0, min(len(items)-1, state.Cursor))
+		state.VScroll = max(0, min(state.VScroll, state.Cursor))
+	}
 
 	for i := range height {
 		index := state.VScroll + i
@@ -41,12 +71,27 @@ func List[Item any](r Renderer, props ListProps[Item]) EventHandler {
 		if index < len(props.Items) {
 			itemStr := props.RenderFunc(props.Items[index])
 			text := utils.ScrollString(itemStr, state.HScroll, width, " ")
-			rendered = append(rendered, text)
 
 			isSelected := props.ShowSelected && index == state.Cursor
 			style := theme.ListItem(isSelected)
 
 			r.PutStrStyled(0, i, text, style)
+
+			if len(props.Filter) == 0 {
+				continue
+			}
+			offset := strings.Index(itemStr, filterText(props.Items[index]))
+			if offset < 0 {
+				continue
+			}
+			runes := []rune(itemStr)
+			start := utf8.RuneCountInString(itemStr[:offset])
+			for _, pos := range matches[index] {
+				x := start + pos - state.HScroll
+				if x >= 0 && x < width && start+pos < len(runes) {
+					r.PutStrStyled(x, i, string(runes[start+pos]), theme.Highlight(style))
+				}
+			}
 		}
 	}
 
@@ -124,13 +124,14 @@ func (r *RegionRenderer) GetScreen() Renderer {
 	return r.Renderer.GetScreen()
 }
 
+// Sub-regions add the region's position, so splitting r.Rect would add it twice.
 func (r *RegionRenderer) SplitHorizontal(x int) (Renderer, Renderer) {
-	left, right := r.Rect.SplitHorizontal(x)
+	left, right := Rect{Size: r.Rect.Size}.SplitHorizontal(x)
 	return r.SubRegion(left), r.SubRegion(right)
 }
 
 func (r *RegionRenderer) SplitVertical(y int) (Renderer, Renderer) {
-	top, bottom := r.Rect.SplitVertical(y)
+	top, bottom := Rect{Size: r.Rect.Size}.SplitVertical(y)
 	return r.SubRegion(top), r.SubRegion(bottom)
 }
 
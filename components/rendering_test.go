@@ -0,0 +1,53 @@
+package components
+
+import (
+	"testing"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+// Gets the text of a row of the screen.
+func screenRow(screen t.SimulationScreen, y int) string {
+	cells, width, _ := screen.GetContents()
+	row := ""
+	for _, cell := range cells[y*width : (y+1)*width] {
+		row += string(cell.Runes)
+	}
+	return row
+}
+
+func TestSplitNestedRegions(tt *testing.T) {
+	screen := t.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		tt.Fatal(err)
+	}
+	defer screen.Fini()
+	screen.SetSize(10, 4)
+	screen.Fill('.', t.StyleDefault)
+
+	// a region that does not start at the screen's origin, like the inside of
+	// a box, split both ways
+	region := NewScreenRenderer(screen).SubRegion(NewRect(2, 1, 6, 3))
+	left, right := region.SplitHorizontal(2)
+	top, bottom := right.SplitVertical(1)
+	left.Fill('L', t.StyleDefault)
+	top.Fill('T', t.StyleDefault)
+	bottom.Fill('B', t.StyleDefault)
+	screen.Show()
+
+	want := []string{
+		"..........",
+		"..LLTTTT..",
+		"..LLBBBB..",
+		"..LLBBBB..",
+	}
+	for y, row := range want {
+		if got := screenRow(screen, y); got != row {
+			tt.Errorf("row %d = %q, want %q", y, got, row)
+		}
+	}
+
+	if rect := bottom.GetRegion(); rect != NewRect(0, 1, 4, 2) {
+		tt.Errorf("bottom region = %+v, want it relative to its parent", rect)
+	}
+}
@@ -1,6 +1,9 @@
 package components
 
 import (
+	"unicode/utf8"
+
+	"github.com/mecha/journal/theme"
 	"github.com/mecha/journal/utils"
 
 	t "github.com/gdamore/tcell/v2"
@@ -12,8 +15,9 @@ type TextProps struct {
 }
 
 type TextState struct {
-	Scroll Pos
-	Lines  []string
+	Scroll     Pos
+	Lines      []string
+	Highlights []string
 }
 
 func Text(r Renderer, props TextProps) EventHandler {
@@ -37,6 +41,16 @@ func Text(r Renderer, props TextProps) EventHandler {
 		right := min(len(line), state.Scroll.X+width)
 		row := utils.FixedString(line[left:right], width, " ")
 		r.PutStrStyled(0, i, row, props.Style)
+
+		for _, highlight := range state.Highlights {
+			for _, start := range utils.IndexAllFold(line, highlight) {
+				start, end := max(left, start), min(right, start+len(highlight))
+				if start < end {
+					x := utf8.RuneCountInString(line[left:start])
+					r.PutStrStyled(x, i, line[start:end], theme.Highlight(props.Style))
+				}
+			}
+		}
 	}
 
 	return HandleKey(func(ev *t.EventKey) bool {
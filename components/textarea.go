@@ -0,0 +1,420 @@
+package components
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mecha/journal/theme"
+
+	t "github.com/gdamore/tcell/v2"
+	"github.com/rivo/uniseg"
+)
+
+type TextAreaProps struct {
+	State      *TextAreaState
+	Style      t.Style
+	HideCursor bool
+	// Ctrl-S
+	OnSave func(text string)
+	// Esc
+	OnExit func(text string)
+}
+
+// Positions are indexes of runes in the lines, not screen columns.
+type TextAreaState struct {
+	Lines  [][]rune
+	Cursor Pos
+	// the other end of the selection
+	Anchor      Pos
+	IsSelecting bool
+	// counts wrapped lines as several rows
+	Scroll   int
+	Modified bool
+
+	saved    string
+	undo     []textAreaSnapshot
+	redo     []textAreaSnapshot
+	lastEdit textAreaEdit
+}
+
+type textAreaSnapshot struct {
+	lines  [][]rune
+	cursor Pos
+}
+
+type textAreaEdit int
+
+const (
+	editNone textAreaEdit = iota
+	editInsert
+	editDelete
+	editOther
+)
+
+type textAreaRow struct {
+	line, start, end int
+}
+
+func NewTextAreaState(text string) *TextAreaState {
+	state := &TextAreaState{}
+	state.SetText(text)
+	return state
+}
+
+func (state *TextAreaState) SetText(text string) {
+	state.Lines = [][]rune{}
+	for _, line := range strings.Split(text, "\n") {
+		state.Lines = append(state.Lines, []rune(line))
+	}
+	state.Cursor = Pos{}
+	state.IsSelecting = false
+	state.Scroll = 0
+	state.Modified = false
+	state.saved = text
+	state.undo = nil
+	state.redo = nil
+	state.lastEdit = editNone
+}
+
+func (state *TextAreaState) Text() string {
+	lines := make([]string, len(state.Lines))
+	for i, line := range state.Lines {
+		lines[i] = string(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Starts a new undo group, so that undoing can go back to the saved text.
+func (state *TextAreaState) MarkSaved() {
+	state.saved = state.Text()
+	state.Modified = false
+	state.lastEdit = editNone
+}
+
+// Consecutive edits of the same kind are undone together.
+func (state *TextAreaState) record(edit textAreaEdit) {
+	state.redo = nil
+	if edit != editOther && edit == state.lastEdit {
+		return
+	}
+	state.lastEdit = edit
+	state.undo = append(state.undo, state.snapshot())
+}
+
+func (state *TextAreaState) snapshot() textAreaSnapshot {
+	lines := make([][]rune, len(state.Lines))
+	for i, line := range state.Lines {
+		lines[i] = slices.Clone(line)
+	}
+	return textAreaSnapshot{lines, state.Cursor}
+}
+
+func (state *TextAreaState) restore(from, to *[]textAreaSnapshot) {
+	if len(*from) == 0 {
+		return
+	}
+	*to = append(*to, state.snapshot())
+	snapshot := (*from)[len(*from)-1]
+	*from = (*from)[:len(*from)-1]
+
+	state.Lines = snapshot.lines
+	state.Cursor = snapshot.cursor
+	state.IsSelecting = false
+	state.Modified = state.Text() != state.saved
+	state.lastEdit = editNone
+}
+
+func (state *TextAreaState) Undo() { state.restore(&state.undo, &state.redo) }
+func (state *TextAreaState) Redo() { state.restore(&state.redo, &state.undo) }
+
+func (state *TextAreaState) selection() (Pos, Pos, bool) {
+	if !state.IsSelecting || state.Anchor == state.Cursor {
+		return Pos{}, Pos{}, false
+	}
+	if isBefore(state.Anchor, state.Cursor) {
+		return state.Anchor, state.Cursor, true
+	}
+	return state.Cursor, state.Anchor, true
+}
+
+func (state *TextAreaState) Selection() string {
+	from, to, ok := state.selection()
+	if !ok {
+		return ""
+	}
+	if from.Y == to.Y {
+		return string(state.Lines[from.Y][from.X:to.X])
+	}
+	parts := []string{string(state.Lines[from.Y][from.X:])}
+	for _, line := range state.Lines[from.Y+1 : to.Y] {
+		parts = append(parts, string(line))
+	}
+	parts = append(parts, string(state.Lines[to.Y][:to.X]))
+	return strings.Join(parts, "\n")
+}
+
+func (state *TextAreaState) deleteRange(from, to Pos) {
+	tail := state.Lines[to.Y][to.X:]
+	state.Lines[from.Y] = append(slices.Clone(state.Lines[from.Y][:from.X]), tail...)
+	state.Lines = slices.Delete(state.Lines, from.Y+1, to.Y+1)
+	state.Cursor = from
+	state.Modified = state.Text() != state.saved
+}
+
+func (state *TextAreaState) deleteSelection() bool {
+	from, to, ok := state.selection()
+	state.IsSelecting = false
+	if !ok {
+		return false
+	}
+	state.record(editOther)
+	state.deleteRange(from, to)
+	return true
+}
+
+func (state *TextAreaState) Insert(text string) {
+	edit := editInsert
+	if strings.ContainsAny(text, " \n") {
+		edit = editOther
+	}
+	if !state.deleteSelection() {
+		state.record(edit)
+	}
+
+	y := state.Cursor.Y
+	line := state.Lines[y]
+	head, tail := slices.Clone(line[:state.Cursor.X]), slices.Clone(line[state.Cursor.X:])
+
+	inserted := [][]rune{}
+	for _, newLine := range strings.Split(text, "\n") {
+		inserted = append(inserted, []rune(newLine))
+	}
+	inserted[0] = append(head, inserted[0]...)
+	last := len(inserted) - 1
+	state.Cursor = Pos{len(inserted[last]), y + last}
+	inserted[last] = append(inserted[last], tail...)
+
+	state.Lines = slices.Replace(state.Lines, y, y+1, inserted...)
+	state.Modified = state.Text() != state.saved
+}
+
+func (state *TextAreaState) Backspace() {
+	if state.deleteSelection() {
+		return
+	}
+	cursor := state.Cursor
+	switch {
+	case cursor.X > 0:
+		state.record(editDelete)
+		state.deleteRange(cursor.Add(-1, 0), cursor)
+	case cursor.Y > 0:
+		state.record(editOther)
+		state.deleteRange(Pos{len(state.Lines[cursor.Y-1]), cursor.Y - 1}, cursor)
+	}
+}
+
+func (state *TextAreaState) Delete() {
+	if state.deleteSelection() {
+		return
+	}
+	cursor := state.Cursor
+	switch {
+	case cursor.X < len(state.Lines[cursor.Y]):
+		state.record(editDelete)
+		state.deleteRange(cursor, cursor.Add(1, 0))
+	case cursor.Y < len(state.Lines)-1:
+		state.record(editOther)
+		state.deleteRange(cursor, Pos{0, cursor.Y + 1})
+	}
+}
+
+func (state *TextAreaState) moveTo(pos Pos, extend bool) {
+	if extend && !state.IsSelecting {
+		state.Anchor = state.Cursor
+	}
+	state.IsSelecting = extend
+	state.Cursor = pos
+	state.lastEdit = editNone
+}
+
+func (state *TextAreaState) SelectAll() {
+	last := len(state.Lines) - 1
+	state.Anchor = Pos{}
+	state.Cursor = Pos{len(state.Lines[last]), last}
+	state.IsSelecting = true
+}
+
+func textWidth(runes []rune) int {
+	return uniseg.StringWidth(string(runes))
+}
+
+func wrapLines(lines [][]rune, width int) []textAreaRow {
+	width = max(1, width)
+	rows := []textAreaRow{}
+	for i, line := range lines {
+		start, col := 0, 0
+		for j, char := range line {
+			charWidth := textWidth([]rune{char})
+			if col+charWidth > width && j > start {
+				end := j
+				for k := j; k > start+1; k-- {
+					if line[k-1] == ' ' {
+						end = k
+						break
+					}
+				}
+				rows = append(rows, textAreaRow{i, start, end})
+				start = end
+				col = textWidth(line[start:j])
+			}
+			col += charWidth
+		}
+		rows = append(rows, textAreaRow{i, start, len(line)})
+	}
+	return rows
+}
+
+func findColumn(line []rune, row textAreaRow, column int) int {
+	x, col := row.start, 0
+	for ; x < row.end; x++ {
+		charWidth := textWidth(line[x : x+1])
+		if col+charWidth > column {
+			break
+		}
+		col += charWidth
+	}
+	return x
+}
+
+// The end of a wrapped row is the start of the next one.
+func findRow(rows []textAreaRow, pos Pos) int {
+	for i, row := range rows {
+		if row.line == pos.Y && pos.X >= row.start && (pos.X < row.end || i == len(rows)-1 || rows[i+1].line != pos.Y) {
+			return i
+		}
+	}
+	return 0
+}
+
+func isBefore(a, b Pos) bool {
+	return a.Y < b.Y || a.Y == b.Y && a.X < b.X
+}
+
+func TextArea(r Renderer, props TextAreaProps) EventHandler {
+	state := props.State
+	width, height := r.Size()
+
+	// one column is left free for the cursor at the end of full rows
+	rows := wrapLines(state.Lines, width-1)
+	cursorRow := findRow(rows, state.Cursor)
+	if cursorRow < state.Scroll {
+		state.Scroll = cursorRow
+	} else if cursorRow >= state.Scroll+height {
+		state.Scroll = cursorRow - height + 1
+	}
+	state.Scroll = max(0, min(state.Scroll, len(rows)-1))
+
+	from, to, hasSelection := state.selection()
+	selectStyle := theme.ListSelect(props.Style)
+	for y, row := range rows[state.Scroll:min(len(rows), state.Scroll+height)] {
+		line := state.Lines[row.line]
+		r.PutStrStyled(0, y, string(line[row.start:row.end]), props.Style)
+
+		if !hasSelection {
+			continue
+		}
+		for x := row.start; x < row.end; x++ {
+			pos := Pos{x, row.line}
+			if !isBefore(pos, from) && isBefore(pos, to) {
+				r.PutStrStyled(textWidth(line[row.start:x]), y, string(line[x]), selectStyle)
+			}
+		}
+		// show that the line break is selected
+		if row.end == len(line) && !isBefore(Pos{row.end, row.line}, from) && isBefore(Pos{row.end, row.line}, to) {
+			r.PutStrStyled(textWidth(line[row.start:row.end]), y, " ", selectStyle)
+		}
+	}
+
+	if !props.HideCursor {
+		row := rows[cursorRow]
+		line := state.Lines[row.line]
+		r.ShowCursor(textWidth(line[row.start:state.Cursor.X]), cursorRow-state.Scroll)
+	}
+
+	// moves the cursor by some rows, keeping it in the same column
+	moveRows := func(offset int, extend bool) {
+		row := rows[cursorRow]
+		target := rows[max(0, min(len(rows)-1, cursorRow+offset))]
+		column := textWidth(state.Lines[row.line][row.start:state.Cursor.X])
+		x := findColumn(state.Lines[target.line], target, column)
+		// the end of a wrapped row is the start of the next one
+		if x == target.end && target.end < len(state.Lines[target.line]) {
+			x = max(target.start, x-1)
+		}
+		state.moveTo(Pos{x, target.line}, extend)
+	}
+
+	return HandleKey(func(ev *t.EventKey) bool {
+		cursor := state.Cursor
+		extend := ev.Modifiers()&t.ModShift != 0
+		line := state.Lines[cursor.Y]
+
+		switch ev.Key() {
+		default:
+			return false
+
+		case t.KeyRune:
+			state.Insert(string(ev.Rune()))
+		case t.KeyEnter:
+			state.Insert("\n")
+		case t.KeyBackspace, t.KeyBackspace2:
+			state.Backspace()
+		case t.KeyDelete:
+			state.Delete()
+
+		case t.KeyLeft:
+			switch {
+			case cursor.X > 0:
+				state.moveTo(cursor.Add(-1, 0), extend)
+			case cursor.Y > 0:
+				state.moveTo(Pos{len(state.Lines[cursor.Y-1]), cursor.Y - 1}, extend)
+			}
+		case t.KeyRight:
+			switch {
+			case cursor.X < len(line):
+				state.moveTo(cursor.Add(1, 0), extend)
+			case cursor.Y < len(state.Lines)-1:
+				state.moveTo(Pos{0, cursor.Y + 1}, extend)
+			}
+		case t.KeyUp:
+			moveRows(-1, extend)
+		case t.KeyDown:
+			moveRows(1, extend)
+		case t.KeyPgUp:
+			moveRows(-height, extend)
+		case t.KeyPgDn:
+			moveRows(height, extend)
+		case t.KeyHome:
+			state.moveTo(Pos{0, cursor.Y}, extend)
+		case t.KeyEnd:
+			state.moveTo(Pos{len(line), cursor.Y}, extend)
+
+		case t.KeyCtrlA:
+			state.SelectAll()
+		case t.KeyCtrlZ:
+			state.Undo()
+		case t.KeyCtrlY:
+			state.Redo()
+
+		case t.KeyCtrlS:
+			if props.OnSave != nil {
+				props.OnSave(state.Text())
+			}
+		case t.KeyEsc:
+			if props.OnExit != nil {
+				props.OnExit(state.Text())
+			}
+		}
+		return true
+	})
+}
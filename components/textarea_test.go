@@ -0,0 +1,264 @@
+package components
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+// Draws a text area on a screen and sends it some key presses.
+func pressTextArea(tt *testing.T, state *TextAreaState, keys ...*t.EventKey) {
+	screen := t.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		tt.Fatal(err)
+	}
+	defer screen.Fini()
+	screen.SetSize(10, 5)
+
+	for _, key := range keys {
+		handler := TextArea(NewScreenRenderer(screen), TextAreaProps{State: state})
+		handler(key)
+	}
+}
+
+func TestTextAreaUndo(tt *testing.T) {
+	state := NewTextAreaState("hi")
+	state.Cursor = Pos{2, 0}
+
+	// typing a word is undone at once, but not the space before it
+	for _, r := range " there" {
+		state.Insert(string(r))
+	}
+	if got := state.Text(); got != "hi there" {
+		tt.Fatalf("text = %q", got)
+	}
+	state.Undo()
+	if got := state.Text(); got != "hi " {
+		tt.Errorf("text after undo = %q, want %q", got, "hi ")
+	}
+	state.Undo()
+	if got := state.Text(); got != "hi" || state.Modified {
+		tt.Errorf("text after undo = %q, modified = %t, want the original text", got, state.Modified)
+	}
+	state.Undo()
+	if got := state.Text(); got != "hi" {
+		tt.Errorf("undo with no history changed the text to %q", got)
+	}
+
+	state.Redo()
+	state.Redo()
+	if got := state.Text(); got != "hi there" || !state.Modified {
+		tt.Errorf("text after redo = %q, modified = %t", got, state.Modified)
+	}
+	if state.Cursor != (Pos{8, 0}) {
+		tt.Errorf("cursor after redo = %v, want the end of the text", state.Cursor)
+	}
+
+	// moving the cursor starts a new group
+	state.Backspace()
+	state.moveTo(Pos{2, 0}, false)
+	state.Backspace()
+	state.Undo()
+	if got := state.Text(); got != "hi ther" {
+		tt.Errorf("text after undo = %q, want %q", got, "hi ther")
+	}
+
+	// a new edit clears the redo history
+	state.Insert("!")
+	state.Redo()
+	if got := state.Text(); got != "hi! ther" {
+		tt.Errorf("redo after an edit changed the text to %q", got)
+	}
+}
+
+func TestTextAreaModified(tt *testing.T) {
+	state := NewTextAreaState("a")
+	state.Cursor = Pos{1, 0}
+
+	state.Insert("b")
+	state.MarkSaved()
+	if state.Modified {
+		tt.Error("text is modified after saving it")
+	}
+	state.Insert("c")
+	state.Backspace()
+	if state.Modified {
+		tt.Error("text is modified after deleting what was typed")
+	}
+	state.Undo()
+	if got := state.Text(); got != "abc" || !state.Modified {
+		tt.Errorf("text after undo = %q, modified = %t", got, state.Modified)
+	}
+	// saving starts a new group, so undoing stops at the saved text
+	state.Undo()
+	if got := state.Text(); got != "ab" || state.Modified {
+		tt.Errorf("text after undo = %q, modified = %t, want the saved text", got, state.Modified)
+	}
+	state.Undo()
+	if got := state.Text(); got != "a" || !state.Modified {
+		tt.Errorf("text after undo = %q, modified = %t, want it to differ from the saved text", got, state.Modified)
+	}
+}
+
+func TestWrapLines(tt *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		width int
+		rows  []string
+	}{
+		{"short lines", []string{"ab", "", "cd"}, 4, []string{"ab", "", "cd"}},
+		{"full row", []string{"abcd"}, 4, []string{"abcd"}},
+		{"after a space", []string{"ab cd ef"}, 6, []string{"ab cd ", "ef"}},
+		{"long word", []string{"abcdefghij"}, 4, []string{"abcd", "efgh", "ij"}},
+		{"wide runes", []string{"日本語です"}, 4, []string{"日本", "語で", "す"}},
+		{"wide rune at the end of a row", []string{"ab日本"}, 3, []string{"ab", "日", "本"}},
+		{"wide runes after a space", []string{"a 日本語"}, 6, []string{"a ", "日本語"}},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			lines := [][]rune{}
+			for _, line := range test.lines {
+				lines = append(lines, []rune(line))
+			}
+			rows := []string{}
+			for _, row := range wrapLines(lines, test.width) {
+				rows = append(rows, string(lines[row.line][row.start:row.end]))
+			}
+			if !slices.Equal(rows, test.rows) {
+				tt.Errorf("rows = %q, want %q", rows, test.rows)
+			}
+		})
+	}
+}
+
+func TestFindRow(tt *testing.T) {
+	lines := [][]rune{[]rune("日本語です"), []rune("ab")}
+	rows := wrapLines(lines, 4)
+
+	tests := []struct {
+		pos Pos
+		row int
+	}{
+		{Pos{0, 0}, 0},
+		{Pos{1, 0}, 0},
+		// the end of a wrapped row is the start of the next one
+		{Pos{2, 0}, 1},
+		{Pos{4, 0}, 2},
+		// but the end of a line stays in its last row
+		{Pos{5, 0}, 2},
+		{Pos{0, 1}, 3},
+		{Pos{2, 1}, 3},
+	}
+	for _, test := range tests {
+		if got := findRow(rows, test.pos); got != test.row {
+			tt.Errorf("findRow(%v) = %d, want %d", test.pos, got, test.row)
+		}
+	}
+}
+
+func TestTextAreaShiftSelection(tt *testing.T) {
+	state := NewTextAreaState("one\ntwo\nthree")
+	state.Cursor = Pos{1, 0}
+
+	shift := func(key t.Key) *t.EventKey { return t.NewEventKey(key, 0, t.ModShift) }
+	pressTextArea(tt, state, shift(t.KeyRight), shift(t.KeyDown), shift(t.KeyRight))
+	if got := state.Selection(); got != "ne\ntwo" {
+		tt.Errorf("selection = %q, want %q", got, "ne\ntwo")
+	}
+
+	pressTextArea(tt, state, t.NewEventKey(t.KeyDelete, 0, t.ModNone))
+	if got := state.Text(); got != "o\nthree" {
+		tt.Errorf("text after deleting the selection = %q", got)
+	}
+	if state.Cursor != (Pos{1, 0}) || state.IsSelecting {
+		tt.Errorf("cursor = %v, selecting = %t, want the start of the deleted text", state.Cursor, state.IsSelecting)
+	}
+
+	// selecting backwards, then replacing the selection by typing
+	state.Cursor = Pos{3, 1}
+	pressTextArea(tt, state, shift(t.KeyLeft), shift(t.KeyLeft), t.NewEventKey(t.KeyRune, 'x', t.ModNone))
+	if got := state.Text(); got != "o\ntxee" {
+		tt.Errorf("text after typing over the selection = %q", got)
+	}
+
+	// moving without Shift clears the selection
+	pressTextArea(tt, state, shift(t.KeyHome), t.NewEventKey(t.KeyRight, 0, t.ModNone))
+	if state.IsSelecting || state.Selection() != "" {
+		tt.Errorf("selection = %q after moving without Shift", state.Selection())
+	}
+
+	state.Undo()
+	state.Undo()
+	if got := state.Text(); got != "one\ntwo\nthree" {
+		tt.Errorf("text after undoing the deletes = %q", got)
+	}
+}
+
+func TestTextAreaJoinLines(tt *testing.T) {
+	state := NewTextAreaState("ab\ncd\nef")
+
+	state.Cursor = Pos{0, 1}
+	state.Backspace()
+	if got := state.Text(); got != "abcd\nef" || state.Cursor != (Pos{2, 0}) {
+		tt.Errorf("text after backspace = %q, cursor = %v", got, state.Cursor)
+	}
+
+	state.Cursor = Pos{4, 0}
+	state.Delete()
+	if got := state.Text(); got != "abcdef" || state.Cursor != (Pos{4, 0}) {
+		tt.Errorf("text after delete = %q, cursor = %v", got, state.Cursor)
+	}
+
+	// nothing to join at the start and the end of the text
+	state.Cursor = Pos{0, 0}
+	state.Backspace()
+	state.Cursor = Pos{6, 0}
+	state.Delete()
+	if got := state.Text(); got != "abcdef" {
+		tt.Errorf("text = %q, want it unchanged", got)
+	}
+
+	// each join is undone on its own
+	state.Undo()
+	if got := state.Text(); got != "abcd\nef" {
+		tt.Errorf("text after undo = %q", got)
+	}
+	state.Undo()
+	if got := state.Text(); got != "ab\ncd\nef" || state.Modified {
+		tt.Errorf("text after undo = %q, modified = %t", got, state.Modified)
+	}
+}
+
+func TestTextAreaWideRunes(tt *testing.T) {
+	screen := t.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		tt.Fatal(err)
+	}
+	defer screen.Fini()
+	screen.SetSize(6, 3)
+
+	// rows are 5 columns wide, leaving one for the cursor
+	state := NewTextAreaState("日本語です\nabcdef")
+	state.Cursor = Pos{1, 0}
+	handler := TextArea(NewScreenRenderer(screen), TextAreaProps{State: state})
+	screen.Show()
+
+	want := []string{"日本", "語で", "す"}
+	for y, row := range want {
+		if got := strings.TrimRight(screenRow(screen, y), " "); got != row {
+			tt.Errorf("row %d = %q, want %q", y, got, row)
+		}
+	}
+	if x, y, visible := screen.GetCursor(); !visible || x != 2 || y != 0 {
+		tt.Errorf("cursor at %d,%d, want it after the first wide rune", x, y)
+	}
+
+	// moving down keeps the cursor in the same column
+	handler(t.NewEventKey(t.KeyDown, 0, t.ModNone))
+	if state.Cursor != (Pos{3, 0}) {
+		tt.Errorf("cursor = %v after moving down, want %v", state.Cursor, Pos{3, 0})
+	}
+}
@@ -0,0 +1,171 @@
+package components
+
+import (
+	"strings"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+type TreeProps[Item any] struct {
+	State        *TreeState[Item]
+	Roots        []*TreeNode[Item]
+	ShowSelected bool
+	// remembers the expanded and selected nodes when the tree is rebuilt
+	Key        func(item Item) string
+	RenderFunc ListRenderFunc[Item]
+	OnEnter    ListItemFunc[Item]
+	OnSelect   ListItemFunc[Item]
+	// filtering shows a flat list, including the children of collapsed nodes
+	Filter     string
+	FilterText ListRenderFunc[Item]
+}
+
+type TreeState[Item any] struct {
+	List     ListState[treeRow[Item]]
+	Expanded map[string]bool
+	Selected string
+}
+
+type TreeNode[Item any] struct {
+	Item     Item
+	Children []*TreeNode[Item]
+}
+
+type treeRow[Item any] struct {
+	node   *TreeNode[Item]
+	parent int
+	depth  int
+}
+
+func NewTreeState[Item any]() *TreeState[Item] {
+	return &TreeState[Item]{Expanded: map[string]bool{}}
+}
+
+func Tree[Item any](r Renderer, props TreeProps[Item]) EventHandler {
+	state := props.State
+	_, height := r.Size()
+
+	rows := []treeRow[Item]{}
+	var addRows func(nodes []*TreeNode[Item], parent, depth int)
+	addRows = func(nodes []*TreeNode[Item], parent, depth int) {
+		for _, node := range nodes {
+			rows = append(rows, treeRow[Item]{node, parent, depth})
+			if state.Expanded[props.Key(node.Item)] {
+				addRows(node.Children, len(rows)-1, depth+1)
+			}
+		}
+	}
+
+	isFiltered := len(props.Filter) > 0
+	filterText := func(row treeRow[Item]) string { return props.FilterText(row.node.Item) }
+	if isFiltered {
+		var addAll func(nodes []*TreeNode[Item])
+		addAll = func(nodes []*TreeNode[Item]) {
+			for _, node := range nodes {
+				rows = append(rows, treeRow[Item]{node, -1, 0})
+				addAll(node.Children)
+			}
+		}
+		addAll(props.Roots)
+		rows, _ = FilterItems(rows, props.Filter, filterText)
+	} else {
+		addRows(props.Roots, -1, 0)
+	}
+
+	// keep the selected node selected, even if the rows have changed
+	for i, row := range rows {
+		if props.Key(row.node.Item) == state.Selected {
+			state.List.Cursor = i
+		}
+	}
+	state.List.Cursor = max(0, min(len(rows)-1, state.List.Cursor))
+	if len(rows) > 0 {
+		state.Selected = props.Key(rows[state.List.Cursor].node.Item)
+	}
+	if state.List.Cursor < state.List.VScroll {
+		state.List.VScroll = state.List.Cursor
+	} else if state.List.Cursor >= state.List.VScroll+height {
+		state.List.VScroll = state.List.Cursor - height + 1
+	}
+	// collapsing nodes can leave the list scrolled past its end
+	state.List.VScroll = max(0, min(state.List.VScroll, len(rows)-height))
+
+	listHandler := List(r, ListProps[treeRow[Item]]{
+		State:        &state.List,
+		Items:        rows,
+		ShowSelected: props.ShowSelected,
+		Filter:       props.Filter,
+		FilterText:   filterText,
+		RenderFunc: func(row treeRow[Item]) string {
+			if isFiltered {
+				return props.RenderFunc(row.node.Item)
+			}
+			marker := "  "
+			if len(row.node.Children) > 0 {
+				if state.Expanded[props.Key(row.node.Item)] {
+					marker = "▾ "
+				} else {
+					marker = "▸ "
+				}
+			}
+			return strings.Repeat("  ", row.depth) + marker + props.RenderFunc(row.node.Item)
+		},
+		OnSelect: func(i int, row treeRow[Item]) {
+			if props.OnSelect != nil {
+				props.OnSelect(i, row.node.Item)
+			}
+		},
+		OnEnter: func(i int, row treeRow[Item]) {
+			if props.OnEnter != nil {
+				props.OnEnter(i, row.node.Item)
+			}
+		},
+	})
+
+	selectRow := func(i int) {
+		state.List.Cursor = i
+		state.Selected = props.Key(rows[i].node.Item)
+		if props.OnSelect != nil {
+			props.OnSelect(i, rows[i].node.Item)
+		}
+	}
+
+	return func(ev t.Event) bool {
+		if len(rows) == 0 {
+			return false
+		}
+		row := rows[state.List.Cursor]
+		key := props.Key(row.node.Item)
+
+		if ev, isKey := ev.(*t.EventKey); isKey && !isFiltered {
+			isRune := ev.Key() == t.KeyRune
+			switch {
+			case ev.Key() == t.KeyRight || isRune && ev.Rune() == 'l':
+				if len(row.node.Children) > 0 {
+					state.Expanded[key] = true
+				}
+				return true
+
+			case ev.Key() == t.KeyLeft || isRune && ev.Rune() == 'h':
+				if state.Expanded[key] {
+					delete(state.Expanded, key)
+				} else if row.parent >= 0 {
+					selectRow(row.parent)
+				}
+				return true
+
+			case isRune && ev.Rune() == ' ':
+				if state.Expanded[key] {
+					delete(state.Expanded, key)
+				} else if len(row.node.Children) > 0 {
+					state.Expanded[key] = true
+				}
+				return true
+			}
+		}
+
+		handled := listHandler(ev)
+		state.Selected = props.Key(rows[state.List.Cursor].node.Item)
+		return handled
+	}
+}
@@ -0,0 +1,107 @@
+package components
+
+import (
+	"strings"
+	"testing"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+func TestTree(tt *testing.T) {
+	screen := t.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		tt.Fatal(err)
+	}
+	defer screen.Fini()
+	screen.SetSize(20, 10)
+
+	leaf := func(name string) *TreeNode[string] { return &TreeNode[string]{Item: name} }
+	roots := []*TreeNode[string]{
+		{Item: "work", Children: []*TreeNode[string]{
+			leaf("work/a"),
+			{Item: "work/b", Children: []*TreeNode[string]{leaf("work/b/x")}},
+		}},
+		leaf("gym"),
+	}
+	state := NewTreeState[string]()
+	filter := ""
+
+	draw := func() (EventHandler, []string) {
+		screen.Clear()
+		handler := Tree(NewScreenRenderer(screen), TreeProps[string]{
+			State:        state,
+			Roots:        roots,
+			ShowSelected: true,
+			Key:          func(item string) string { return item },
+			RenderFunc:   func(item string) string { return item },
+			Filter:       filter,
+			FilterText:   func(item string) string { return item },
+		})
+		screen.Show()
+		rows := []string{}
+		for y := range 10 {
+			if row := strings.TrimSpace(screenRow(screen, y)); len(row) > 0 {
+				rows = append(rows, row)
+			}
+		}
+		return handler, rows
+	}
+	press := func(key t.Key, r rune) {
+		handler, _ := draw()
+		handler(t.NewEventKey(key, r, t.ModNone))
+	}
+
+	steps := []struct {
+		name     string
+		key      t.Key
+		rune     rune
+		rows     []string
+		selected string
+	}{
+		{"collapsed", t.KeyRune, 0, []string{"▸ work", "gym"}, "work"},
+		{"expand", t.KeyRight, 0, []string{"▾ work", "work/a", "▸ work/b", "gym"}, "work"},
+		{"expanding a leaf does nothing", t.KeyRune, 'l', []string{"▾ work", "work/a", "▸ work/b", "gym"}, "work"},
+		{"down", t.KeyDown, 0, []string{"▾ work", "work/a", "▸ work/b", "gym"}, "work/a"},
+		{"down", t.KeyDown, 0, []string{"▾ work", "work/a", "▸ work/b", "gym"}, "work/b"},
+		{"toggle", t.KeyRune, ' ', []string{"▾ work", "work/a", "▾ work/b", "work/b/x", "gym"}, "work/b"},
+		{"down", t.KeyDown, 0, []string{"▾ work", "work/a", "▾ work/b", "work/b/x", "gym"}, "work/b/x"},
+		{"left selects the parent", t.KeyLeft, 0, []string{"▾ work", "work/a", "▾ work/b", "work/b/x", "gym"}, "work/b"},
+		{"left collapses", t.KeyRune, 'h', []string{"▾ work", "work/a", "▸ work/b", "gym"}, "work/b"},
+		{"left selects the parent", t.KeyLeft, 0, []string{"▾ work", "work/a", "▸ work/b", "gym"}, "work"},
+		{"toggle", t.KeyRune, ' ', []string{"▸ work", "gym"}, "work"},
+	}
+	for _, step := range steps {
+		if step.key != t.KeyRune || step.rune != 0 {
+			press(step.key, step.rune)
+		}
+		_, rows := draw()
+		for i := range rows {
+			rows[i] = strings.Join(strings.Fields(rows[i]), " ")
+		}
+		if !equalStrings(rows, step.rows) || state.Selected != step.selected {
+			tt.Errorf("%s: rows = %q with %q selected, want %q with %q selected", step.name, rows, state.Selected, step.rows, step.selected)
+		}
+	}
+
+	// a collapsed tree is never scrolled past its end
+	state.List.VScroll = 3
+	if _, rows := draw(); len(rows) != 2 || state.List.VScroll != 0 {
+		tt.Errorf("rows = %q scrolled by %d after collapsing", rows, state.List.VScroll)
+	}
+
+	// the selection follows its node when the tree changes
+	roots = append([]*TreeNode[string]{leaf("art")}, roots...)
+	if draw(); state.Selected != "work" || state.List.Cursor != 1 {
+		tt.Errorf("selected %q at %d after adding a node before it", state.Selected, state.List.Cursor)
+	}
+
+	// filtering flattens the tree, including collapsed nodes
+	filter = "x"
+	if _, rows := draw(); !equalStrings(rows, []string{"work/b/x"}) {
+		tt.Errorf("filtered rows = %q", rows)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	return strings.Join(a, "\n") == strings.Join(b, "\n")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var Config struct {
+	gocryptfsArgs  []string
+	editorLauncher string
+	editorMode     string
+	editorAltMode  string
+	stageEdits     bool
+}
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "journal", "config"), nil
+}
+
+func loadConfig(path, profile string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) && len(profile) == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	section := ""
+	hasProfile := false
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if name, isSection := strings.CutPrefix(line, "["); isSection {
+			name, closed := strings.CutSuffix(name, "]")
+			if !closed || len(strings.TrimSpace(name)) == 0 {
+				return fmt.Errorf("%s:%d: invalid profile %q", path, lineNum, line)
+			}
+			section = strings.TrimSpace(name)
+			hasProfile = hasProfile || section == profile
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return fmt.Errorf("%s:%d: expected \"key = value\", got %q", path, lineNum, line)
+		}
+		if len(section) > 0 && section != profile {
+			continue
+		}
+
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "gocryptfs_args":
+			Config.gocryptfsArgs, err = splitArgs(value)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+			}
+		case "editor_launcher":
+			Config.editorLauncher = value
+		case "editor_mode":
+			Config.editorMode = value
+		case "editor_alt_mode":
+			Config.editorAltMode = value
+		case "vault_external_editor":
+			Config.stageEdits, err = strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s must be true or false, got %q", path, lineNum, key, value)
+			}
+		default:
+			return fmt.Errorf("%s:%d: unknown setting %q", path, lineNum, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(profile) > 0 && !hasProfile {
+		return errors.New("no profile named " + profile + " in " + path)
+	}
+
+	return nil
+}
+
+// Splits arguments like a shell would, with quotes and backslashes.
+func splitArgs(line string) ([]string, error) {
+	args := []string{}
+	arg := strings.Builder{}
+	inArg := false
+	quote := rune(0)
+	escaped := false
+
+	for _, char := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(char)
+			escaped = false
+		case char == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0 && char == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(char)
+		case char == '\'' || char == '"':
+			quote = char
+			inArg = true
+		case char == ' ' || char == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(char)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("missing closing %c", quote)
+	}
+	if escaped {
+		return nil, errors.New("nothing to escape after the last \\")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
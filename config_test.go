@@ -0,0 +1,34 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", []string{}},
+		{"  -noprealloc   -kernel_cache ", []string{"-noprealloc", "-kernel_cache"}},
+		{`-config "/path/to/my journal.conf"`, []string{"-config", "/path/to/my journal.conf"}},
+		{`-config '/path/with "quotes"'`, []string{"-config", `/path/with "quotes"`}},
+		{`-config /path/to/my\ journal.conf`, []string{"-config", "/path/to/my journal.conf"}},
+		{`-fsname=""`, []string{"-fsname="}},
+		{`""`, []string{""}},
+		{`'a\b'`, []string{`a\b`}},
+	}
+	for _, test := range tests {
+		args, err := splitArgs(test.line)
+		if err != nil || !slices.Equal(args, test.want) {
+			t.Errorf("splitArgs(%q) = %q, %v, want %q", test.line, args, err, test.want)
+		}
+	}
+
+	for _, line := range []string{`-config "/path`, `-config '/path`, `-config \`} {
+		if _, err := splitArgs(line); err == nil {
+			t.Errorf("splitArgs(%q) did not fail", line)
+		}
+	}
+}
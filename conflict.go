@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	c "github.com/mecha/journal/components"
+	"github.com/mecha/journal/theme"
+	"github.com/mecha/journal/utils"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+type EditSession struct {
+	Date time.Time
+	// the entry as the editor knows it, from when it was opened or last saved
+	ModTime time.Time
+	Hash    [sha256.Size]byte
+	// what SaveEdit last saved, which was already checked for conflicts
+	SavedHash [sha256.Size]byte
+	Base      string
+}
+
+type Conflict struct {
+	Date        time.Time
+	Overwritten string
+	Saved       string
+}
+
+func (j *Journal) BeginEdit(date time.Time) *EditSession {
+	content, _, err := j.GetEntry(date)
+	if err != nil {
+		log.Println(err)
+	}
+	session := &EditSession{Date: date, Hash: sha256.Sum256([]byte(content)), Base: content}
+	if info, err := j.store.Stat(j.EntryPath(date)); err == nil {
+		session.ModTime = info.ModTime()
+	}
+
+	j.sessionsMu.Lock()
+	defer j.sessionsMu.Unlock()
+
+	if slices.ContainsFunc(j.sessions, func(s *EditSession) bool { return s.Date.Equal(date) }) {
+		log.Printf("warning: %s is already open in another editor, saving one may undo the changes of the other", j.EntryPath(date))
+	}
+	j.sessions = append(j.sessions, session)
+	return session
+}
+
+// Unmounting ends all sessions, even of editors that stay open.
+func (j *Journal) ResumeEdit(session *EditSession) {
+	j.sessionsMu.Lock()
+	defer j.sessionsMu.Unlock()
+	j.sessions = append(j.sessions, session)
+}
+
+func (j *Journal) EndEdit(session *EditSession) {
+	j.sessionsMu.Lock()
+	defer j.sessionsMu.Unlock()
+
+	j.sessions = slices.DeleteFunc(j.sessions, func(s *EditSession) bool { return s == session })
+}
+
+func (j *Journal) IsEditing(except *EditSession) bool {
+	j.sessionsMu.Lock()
+	defer j.sessionsMu.Unlock()
+	return slices.ContainsFunc(j.sessions, func(s *EditSession) bool { return s != except })
+}
+
+func (j *Journal) SaveEdit(session *EditSession, content string) error {
+	path := j.EntryPath(session.Date)
+
+	// the contents only need to be compared if the entry was modified
+	var conflict *Conflict
+	if info, err := j.store.Stat(path); err == nil && !info.ModTime().Equal(session.ModTime) {
+		current, _, err := j.GetEntry(session.Date)
+		if err != nil {
+			return err
+		}
+		if sha256.Sum256([]byte(current)) != session.Hash && current != content {
+			conflict = &Conflict{session.Date, current, content}
+		}
+	}
+
+	j.sessionsMu.Lock()
+	session.Hash = sha256.Sum256([]byte(content))
+	session.SavedHash = session.Hash
+	j.sessionsMu.Unlock()
+
+	if err := j.WriteEntry(session.Date, content); err != nil {
+		return err
+	}
+	if info, err := j.store.Stat(path); err == nil {
+		session.ModTime = info.ModTime()
+	}
+
+	if conflict != nil {
+		j.reportConflict(*conflict)
+	}
+	return nil
+}
+
+// A change that removes lines added by an earlier one was most likely saved
+// by an editor that did not know about them.
+func (j *Journal) checkEdit(date time.Time, before, after string) {
+	j.sessionsMu.Lock()
+	sessions := []*EditSession{}
+	for _, session := range j.sessions {
+		if session.Date.Equal(date) {
+			sessions = append(sessions, session)
+		}
+	}
+	j.sessionsMu.Unlock()
+
+	if len(sessions) == 0 || before == after {
+		return
+	}
+	// changes saved through SaveEdit were already checked, but an editor that
+	// writes back the version it opened can still undo other changes
+	hash, beforeHash := sha256.Sum256([]byte(after)), sha256.Sum256([]byte(before))
+	j.sessionsMu.Lock()
+	isSaved := slices.ContainsFunc(sessions, func(s *EditSession) bool { return s.SavedHash == hash })
+	// nothing was lost if every editor knew the entry as it was before
+	isKnown := !slices.ContainsFunc(sessions, func(s *EditSession) bool { return s.Hash != beforeHash })
+	j.sessionsMu.Unlock()
+	if isSaved || isKnown {
+		return
+	}
+
+	afterLines := map[string]bool{}
+	for _, line := range strings.Split(after, "\n") {
+		afterLines[line] = true
+	}
+	for _, line := range utils.DiffLines(strings.Split(sessions[0].Base, "\n"), strings.Split(before, "\n")) {
+		if line.Op == utils.DiffAdded && len(strings.TrimSpace(line.Text)) > 0 && !afterLines[line.Text] {
+			j.reportConflict(Conflict{date, before, after})
+			return
+		}
+	}
+}
+
+func (j *Journal) reportConflict(conflict Conflict) {
+	if j.onConflict != nil {
+		j.onConflict(conflict)
+	}
+}
+
+type ConflictProps struct {
+	state   *ConflictState
+	journal *Journal
+	onClose func()
+}
+
+type ConflictState struct {
+	conflict Conflict
+	scroll   int
+}
+
+func ConflictView(r c.Renderer, props ConflictProps) c.EventHandler {
+	state := props.state
+	conflict := state.conflict
+	screenWidth, screenHeight := r.GetScreen().Size()
+	region := c.CenteredRegion(r.GetScreen(), screenWidth-4, screenHeight-4)
+	region.Fill(' ', theme.Dialog())
+
+	rows := sideBySide(utils.DiffLines(strings.Split(conflict.Overwritten, "\n"), strings.Split(conflict.Saved, "\n")))
+
+	c.Box(region, c.BoxProps{
+		Title:   fmt.Sprintf("Conflict in %s", conflict.Date.Format("02 Jan 2006")),
+		Borders: c.BordersRound,
+		Style:   theme.Borders(true, theme.Dialog()),
+		Children: func(r c.Renderer) c.EventHandler {
+			width, height := r.Size()
+			headerRegion, rest := r.SplitVertical(1)
+			listHeight := height - 3
+			listRegion, helpRegion := rest.SplitVertical(listHeight)
+			state.scroll = max(0, min(state.scroll, len(rows)-listHeight))
+
+			colWidth := (width - 1) / 2
+			headerRegion.PutStrStyled(0, 0, "Overwritten", theme.Help())
+			headerRegion.PutStrStyled(colWidth+1, 0, "Saved", theme.Help())
+
+			for y := range listHeight {
+				listRegion.PutStrStyled(colWidth, y, "│", theme.BordersNormal(theme.Dialog()))
+				if state.scroll+y >= len(rows) {
+					continue
+				}
+				row := rows[state.scroll+y]
+				for i, side := range []*utils.DiffLine{row.left, row.right} {
+					if side == nil {
+						continue
+					}
+					style := theme.Dialog()
+					switch side.Op {
+					case utils.DiffRemoved:
+						style = theme.DiffRemoved(style)
+					case utils.DiffAdded:
+						style = theme.DiffAdded(style)
+					}
+					listRegion.PutStrStyled(i*(colWidth+1), y, utils.FixedString(side.Text, colWidth, " "), style)
+				}
+			}
+
+			help := "Scroll: ⬍ | Keep saved version: <ESC> | Restore overwritten version: r"
+			if props.journal.IsReadOnly() {
+				help = "Scroll: ⬍ | Close: <ESC>"
+			}
+			helpRegion.PutStrStyled(0, 1, help, theme.Help())
+			return nil
+		},
+	})
+
+	return c.HandleKey(func(ev *t.EventKey) bool {
+		switch ev.Key() {
+		case t.KeyUp:
+			state.scroll--
+		case t.KeyDown:
+			state.scroll++
+		case t.KeyPgUp:
+			state.scroll -= 10
+		case t.KeyPgDn:
+			state.scroll += 10
+		case t.KeyEsc, t.KeyEnter:
+			props.onClose()
+		case t.KeyRune:
+			switch ev.Rune() {
+			case 'k':
+				state.scroll--
+			case 'j':
+				state.scroll++
+			case 'r':
+				if props.journal.IsReadOnly() {
+					log.Println("cannot restore entry,", ErrReadOnly)
+					return true
+				}
+				err := props.journal.WriteEntry(conflict.Date, conflict.Overwritten)
+				if err != nil {
+					log.Println("failed to restore entry; ", err)
+				} else {
+					log.Printf("restored the overwritten version of %s", props.journal.EntryPath(conflict.Date))
+				}
+				props.onClose()
+			}
+		}
+		return true
+	})
+}
+
+type diffRow struct {
+	left, right *utils.DiffLine
+}
+
+func sideBySide(diff []utils.DiffLine) []diffRow {
+	rows := []diffRow{}
+	for i := 0; i < len(diff); {
+		if diff[i].Op == utils.DiffSame {
+			rows = append(rows, diffRow{&diff[i], &diff[i]})
+			i++
+			continue
+		}
+
+		removed, added := []*utils.DiffLine{}, []*utils.DiffLine{}
+		for ; i < len(diff) && diff[i].Op == utils.DiffRemoved; i++ {
+			removed = append(removed, &diff[i])
+		}
+		for ; i < len(diff) && diff[i].Op == utils.DiffAdded; i++ {
+			added = append(added, &diff[i])
+		}
+		for j := range max(len(removed), len(added)) {
+			row := diffRow{}
+			if j < len(removed) {
+				row.left = removed[j]
+			}
+			if j < len(added) {
+				row.right = added[j]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records the conflicts that a journal reports.
+func watchConflicts(journal *Journal) func() []Conflict {
+	mutex := sync.Mutex{}
+	conflicts := []Conflict{}
+	journal.onConflict = func(conflict Conflict) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		conflicts = append(conflicts, conflict)
+	}
+	return func() []Conflict {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return conflicts
+	}
+}
+
+func TestSaveEditConflict(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{"2025/01/15.md": "# Jan\n"}, false)
+	conflicts := watchConflicts(journal)
+	date := day(2025, 1, 15)
+
+	first := journal.BeginEdit(date)
+	second := journal.BeginEdit(date)
+	if err := journal.SaveEdit(first, "# Jan\nfirst\n"); err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts()) > 0 {
+		t.Fatalf("saving an unchanged entry was a conflict: %v", conflicts())
+	}
+
+	if err := journal.SaveEdit(second, "# Jan\nsecond\n"); err != nil {
+		t.Fatal(err)
+	}
+	want := Conflict{date, "# Jan\nfirst\n", "# Jan\nsecond\n"}
+	if got := conflicts(); len(got) == 0 || got[len(got)-1] != want {
+		t.Errorf("conflicts = %v, want %v", got, want)
+	}
+}
+
+func TestCheckEdit(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{"2025/01/15.md": "# Jan\n"}, false)
+	conflicts := watchConflicts(journal)
+	date := day(2025, 1, 15)
+
+	// an editor that is still open on the original text, and one that saves
+	journal.BeginEdit(date)
+	inline := journal.BeginEdit(date)
+	journal.SaveEdit(inline, "# Jan\nadded\n")
+	count := len(conflicts())
+
+	// the watcher reports the change that was saved by SaveEdit
+	journal.checkEdit(date, "# Jan\n", "# Jan\nadded\n")
+	if len(conflicts()) != count {
+		t.Errorf("a change saved with SaveEdit was reported: %v", conflicts())
+	}
+
+	// the other editor writes back the text it opened
+	journal.checkEdit(date, "# Jan\nadded\n", "# Jan\n")
+	if got := conflicts(); len(got) != count+1 || got[count].Overwritten != "# Jan\nadded\n" {
+		t.Errorf("writing back the original text was not reported: %v", got)
+	}
+}
+
+func TestCheckEditSingleEditor(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{"2025/01/15.md": "# Jan\n"}, false)
+	conflicts := watchConflicts(journal)
+	date := day(2025, 1, 15)
+	journal.BeginEdit(date)
+
+	// the editor saves on top of the version it opened, and again later
+	journal.checkEdit(date, "# Jan\n", "# Jan\nmine\n")
+	journal.checkEdit(date, "# Jan\nmine\n", "# Jan\nmine\nmore\n")
+	if got := conflicts(); len(got) > 0 {
+		t.Fatalf("saves of the only editor were reported: %v", got)
+	}
+
+	// the entry is changed elsewhere, which the editor then overwrites
+	journal.checkEdit(date, "# Jan\nmine\nmore\n", "# Jan\nmine\nmore\nelsewhere\n")
+	journal.checkEdit(date, "# Jan\nmine\nmore\nelsewhere\n", "# Jan\nmine\nmore\n")
+	want := Conflict{date, "# Jan\nmine\nmore\nelsewhere\n", "# Jan\nmine\nmore\n"}
+	if got := conflicts(); len(got) != 1 || got[0] != want {
+		t.Errorf("conflicts = %v, want %v", got, []Conflict{want})
+	}
+}
+
+// A launcher that starts the command without waiting for it.
+type backgroundLauncher struct{}
+
+func (backgroundLauncher) Name() string           { return "background" }
+func (backgroundLauncher) Available() bool        { return true }
+func (backgroundLauncher) Modes() []string        { return []string{"background"} }
+func (backgroundLauncher) Waits(mode string) bool { return false }
+func (backgroundLauncher) Launch(command []string, title, mode string) error {
+	return exec.Command(command[0], command[1:]...).Start()
+}
+
+func TestEditEntryEndsSessionWhenEditorExits(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{"2025/01/15.md": "# Jan\n"}, false)
+	journal.editor = &Editor{Launcher: backgroundLauncher{}, Mode: "background", AltMode: "background"}
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	markerPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { markerPollInterval = time.Second })
+
+	editor := t.TempDir() + "/editor"
+	os.WriteFile(editor, []byte("#!/bin/sh\nsleep 0.2\n"), 0700)
+	t.Setenv("EDITOR", editor)
+
+	if err := journal.EditEntry(day(2025, 1, 15), "background"); err != nil {
+		t.Fatal(err)
+	}
+	openSessions := func() int {
+		journal.sessionsMu.Lock()
+		defer journal.sessionsMu.Unlock()
+		return len(journal.sessions)
+	}
+	if openSessions() != 1 {
+		t.Fatalf("%d sessions while the editor is open", openSessions())
+	}
+
+	for start := time.Now(); openSessions() > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the session did not end after the editor exited")
+		}
+	}
+}
+
+func TestEditEntryStopsWaitingWhenUnmounted(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{"2025/01/15.md": "# Jan\n"}, false)
+	journal.editor = &Editor{Launcher: backgroundLauncher{}, Mode: "background", AltMode: "background"}
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	markerPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { markerPollInterval = time.Second })
+
+	// the editor outlives the test, like a shell that got killed and never
+	// removes its marker
+	editor := t.TempDir() + "/editor"
+	os.WriteFile(editor, []byte("#!/bin/sh\nsleep 5\n"), 0700)
+	t.Setenv("EDITOR", editor)
+
+	if err := journal.EditEntry(day(2025, 1, 15), "background"); err != nil {
+		t.Fatal(err)
+	}
+	markers, _ := filepath.Glob(filepath.Join(runtimeDir, "journal-editor-*"))
+	if len(markers) != 1 {
+		t.Fatalf("markers = %v, want one while the editor is open", markers)
+	}
+
+	journal.Unmount()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(markers[0]); os.IsNotExist(err) {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("still waiting for the editor after unmounting")
+		}
+	}
+}
@@ -18,6 +18,7 @@ type DayPickerProps struct {
 	hasFocus bool
 	date     time.Time
 	OnChange func(time.Time)
+	onEdit   func(date time.Time, altMode bool)
 }
 
 type DayPickerState struct {
@@ -30,7 +31,7 @@ type DayPickerState struct {
 func DayPicker(r c.Renderer, props DayPickerProps) c.EventHandler {
 	state := props.state
 	return c.Box(r, c.BoxProps{
-		Title:   fmt.Sprintf("[1]─%s %d", props.date.Month().String(), props.date.Year()),
+		Title:   panelTitle(props.journal, fmt.Sprintf("[1]─%s %d", props.date.Month().String(), props.date.Year())),
 		Borders: c.BordersRound,
 		Style:   theme.Borders(props.hasFocus),
 		Children: func(r c.Renderer) c.EventHandler {
@@ -91,8 +92,12 @@ func DayPicker(r c.Renderer, props DayPickerProps) c.EventHandler {
 					},
 					OnChoice: func(accepted bool) {
 						if accepted {
-							props.journal.DeleteEntry(props.date)
-							log.Printf("deleted entry: %s", props.journal.EntryPath(props.date))
+							err := props.journal.DeleteEntry(props.date)
+							if err != nil {
+								log.Print(err)
+							} else {
+								log.Printf("deleted entry: %s", props.journal.EntryPath(props.date))
+							}
 						}
 						state.showDelConfirm = false
 					},
@@ -100,7 +105,7 @@ func DayPicker(r c.Renderer, props DayPickerProps) c.EventHandler {
 			}
 
 			return func(ev t.Event) bool {
-				if !props.journal.isMounted {
+				if !props.journal.IsMounted() {
 					return false
 				}
 
@@ -120,10 +125,7 @@ func DayPicker(r c.Renderer, props DayPickerProps) c.EventHandler {
 						return true
 
 					case t.KeyEnter:
-						err := props.journal.EditEntry(props.date, false)
-						if err != nil {
-							log.Print(err)
-						}
+						props.onEdit(props.date, false)
 						return true
 
 					case t.KeyRune:
@@ -135,6 +137,10 @@ func DayPicker(r c.Renderer, props DayPickerProps) c.EventHandler {
 
 					switch ev.Rune() {
 					case 'd':
+						if props.journal.IsReadOnly() {
+							log.Println("cannot delete entry,", ErrReadOnly)
+							return true
+						}
 						if has, _ := props.journal.HasEntry(props.date); has {
 							state.showDelConfirm = true
 							state.delConfirmChoice = false
@@ -146,10 +152,7 @@ func DayPicker(r c.Renderer, props DayPickerProps) c.EventHandler {
 						return true
 
 					case 'e':
-						err := props.journal.EditEntry(props.date, true)
-						if err != nil {
-							log.Print(err)
-						}
+						props.onEdit(props.date, true)
 						return true
 					}
 				}
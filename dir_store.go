@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/farmergreg/rfsnotify"
+	"gopkg.in/fsnotify.v1"
+)
+
+type dirFiles struct {
+	root     string
+	watcher  *rfsnotify.RWatcher
+	onChange func(ev StoreEvent)
+	// the watcher can be stopped by another goroutine
+	mutex sync.Mutex
+}
+
+func newDirFiles(root string) *dirFiles {
+	return &dirFiles{root: strings.TrimSuffix(root, "/")}
+}
+
+func (d *dirFiles) LocalPath(path string) string {
+	if len(path) == 0 {
+		return d.root
+	}
+	return d.root + "/" + path
+}
+
+func (d *dirFiles) List() ([]string, error) {
+	paths := []string{}
+	err := filepath.WalkDir(d.root, func(fpath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			relpath, err := filepath.Rel(d.root, fpath)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, filepath.ToSlash(relpath))
+		}
+		return nil
+	})
+	return paths, err
+}
+
+func (d *dirFiles) Read(path string) ([]byte, error) {
+	return os.ReadFile(d.LocalPath(path))
+}
+
+func (d *dirFiles) Write(fpath string, data []byte) error {
+	dirpath := path.Dir(d.LocalPath(fpath))
+
+	err := os.MkdirAll(dirpath, 0740)
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	if d.watcher != nil {
+		err = d.watcher.Add(dirpath)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	d.mutex.Unlock()
+
+	return writeFileAtomic(d.LocalPath(fpath), data, 0740)
+}
+
+func (d *dirFiles) Delete(path string) error {
+	return os.Remove(d.LocalPath(path))
+}
+
+func (d *dirFiles) Stat(path string) (fs.FileInfo, error) {
+	return os.Stat(d.LocalPath(path))
+}
+
+func (d *dirFiles) Watch(onChange func(ev StoreEvent)) {
+	d.onChange = onChange
+}
+
+// Creates a new watcher every time, so that it can restart after stopWatching.
+func (d *dirFiles) startWatching() {
+	watcher, err := rfsnotify.NewWatcher()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	d.mutex.Lock()
+	d.watcher = watcher
+	d.mutex.Unlock()
+
+	err = watcher.AddRecursive(d.root)
+	if err != nil {
+		log.Println(err)
+	}
+	// the root can change between mounts, so the events of this watcher are
+	// always relative to the root that it was started for
+	go d.handleWatcherEvents(watcher, d.root)
+}
+
+func (d *dirFiles) stopWatching() {
+	d.mutex.Lock()
+	watcher := d.watcher
+	d.watcher = nil
+	d.mutex.Unlock()
+
+	if watcher != nil {
+		watcher.Close()
+	}
+}
+
+func (d *dirFiles) handleWatcherEvents(watcher *rfsnotify.RWatcher, root string) {
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if d.onChange == nil {
+				continue
+			}
+			relpath, err := filepath.Rel(root, ev.Name)
+			if err != nil {
+				continue
+			}
+			d.onChange(StoreEvent{
+				Path:    filepath.ToSlash(relpath),
+				Removed: ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0,
+			})
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println(err)
+		}
+	}
+}
+
+type DirStore struct {
+	*dirFiles
+	isMounted bool
+	onUnmount func()
+}
+
+var _ LocalStore = (*DirStore)(nil)
+
+func NewDirStore(dirPath string) *DirStore {
+	return &DirStore{dirFiles: newDirFiles(dirPath)}
+}
+
+func (s *DirStore) Mount(password string) error {
+	if s.isMounted {
+		return errors.New("journal is already mounted")
+	}
+
+	info, err := os.Stat(s.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory: " + s.root)
+	}
+
+	s.isMounted = true
+	s.startWatching()
+
+	return nil
+}
+
+func (s *DirStore) Unmount() error {
+	if !s.isMounted {
+		return nil
+	}
+
+	s.isMounted = false
+	s.stopWatching()
+	if s.onUnmount != nil {
+		s.onUnmount()
+	}
+
+	return nil
+}
+
+func (s *DirStore) IsMounted() bool {
+	return s.isMounted
+}
+
+func (s *DirStore) OnUnmount(fn func()) {
+	s.onUnmount = fn
+}
+
+// Renames a temporary file, so that the file is never left partially written.
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -2,34 +2,326 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	t "github.com/gdamore/tcell/v2"
 )
 
 var errNoEditor = errors.New("the $EDITOR environment variable is not set")
-var errNoTmux = errors.New("cannot open editor, need to be in tmux")
+var errNoLauncher = errors.New("cannot open editor, need to be in a terminal multiplexer")
+
+type EditorLauncher interface {
+	Name() string
+	Available() bool
+	// The first mode is the default.
+	Modes() []string
+	// Whether Launch returns only after the editor exits.
+	Waits(mode string) bool
+	Launch(command []string, title, mode string) error
+}
+
+// Multiplexers come first, since they usually run inside of a terminal.
+func editorLaunchers(screen t.Screen) []EditorLauncher {
+	return []EditorLauncher{
+		&TmuxLauncher{},
+		&ZellijLauncher{},
+		&ScreenLauncher{},
+		&KittyLauncher{},
+		&WeztermLauncher{},
+		&SuspendLauncher{screen},
+	}
+}
 
-func openEditor(filepath string, title string, window bool) error {
+type Editor struct {
+	Launcher EditorLauncher
+	Mode     string
+	AltMode  string
+	// used when the editor must be waited for, but the launcher cannot wait
+	fallback EditorLauncher
+}
+
+func NewEditor(launcherName, mode, altMode string, screen t.Screen) (*Editor, error) {
+	launchers := editorLaunchers(screen)
+	fallback := launchers[len(launchers)-1]
+
+	var launcher EditorLauncher
+	for _, l := range launchers {
+		if len(launcherName) == 0 && l.Available() || l.Name() == launcherName {
+			launcher = l
+			break
+		}
+	}
+	if launcher == nil && len(launcherName) == 0 {
+		return nil, errNoLauncher
+	}
+	if launcher == nil {
+		names := []string{}
+		for _, l := range launchers {
+			names = append(names, l.Name())
+		}
+		return nil, fmt.Errorf("unknown editor launcher %q, must be one of: %s", launcherName, strings.Join(names, ", "))
+	}
+	if !launcher.Available() {
+		return nil, fmt.Errorf("cannot open the editor with %s, since the app is not running in it", launcher.Name())
+	}
+
+	modes := launcher.Modes()
+	if len(mode) == 0 {
+		mode = modes[0]
+	}
+	if len(altMode) == 0 {
+		altMode = modes[min(1, len(modes)-1)]
+	}
+	for _, m := range []string{mode, altMode} {
+		if !slices.Contains(modes, m) {
+			return nil, fmt.Errorf("unknown mode %q for %s, must be one of: %s", m, launcher.Name(), strings.Join(modes, ", "))
+		}
+	}
+
+	return &Editor{launcher, mode, altMode, fallback}, nil
+}
+
+// The returned channel is closed when the editor exits, or when stop is closed.
+func (e *Editor) Open(path, title, mode string, wait, private bool, stop <-chan struct{}) (<-chan struct{}, error) {
 	editor, hasEditor := os.LookupEnv("EDITOR")
 	if !hasEditor {
-		return errNoEditor
+		return nil, errNoEditor
 	}
 
-	_, isInTmux := os.LookupEnv("TMUX")
-	if !isInTmux {
-		return errNoTmux
+	launcher := e.Launcher
+	if !launcher.Available() {
+		return nil, errNoLauncher
+	}
+	if wait && !launcher.Waits(mode) {
+		waitingModes := slices.DeleteFunc(slices.Clone(launcher.Modes()), func(m string) bool { return !launcher.Waits(m) })
+		switch {
+		case len(waitingModes) > 0:
+			mode = waitingModes[0]
+		case e.fallback.Available():
+			launcher, mode = e.fallback, e.fallback.Modes()[0]
+		default:
+			return nil, fmt.Errorf("cannot open editor, %s cannot wait for it to exit", launcher.Name())
+		}
+		log.Printf("entries in this journal can only be edited in %s mode", mode)
 	}
 
-	var cmd *exec.Cmd
-	if window {
-		cmd = exec.Command("tmux", "neww", "-n", title, editor, filepath)
+	command := editorCommand(editor, path, private)
+	exited := make(chan struct{})
+	marker := ""
+	if launcher.Waits(mode) {
+		close(exited)
 	} else {
-		cmd = exec.Command("tmux", "display-popup", "-w", "100%", "-h", "100%", "-T", title, "-EE", editor, filepath)
+		var err error
+		command, marker, err = markExit(command)
+		if err != nil {
+			return nil, err
+		}
+		go waitForMarker(marker, exited, stop)
+	}
+
+	err := launcher.Launch(command, title, mode)
+	if err != nil {
+		if len(marker) > 0 {
+			os.Remove(marker)
+		}
+		return nil, err
+	}
+	log.Printf("opened entry for editing in %s: %s", editor, path)
+
+	return exited, nil
+}
+
+var markerPollInterval = time.Second
+
+// Launchers that do not wait cannot tell when the editor exits, so a shell
+// removes a marker file when it does.
+func markExit(command []string) ([]string, string, error) {
+	dir, err := runtimeDir()
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := os.CreateTemp(dir, "journal-editor-")
+	if err != nil {
+		return nil, "", err
+	}
+	file.Close()
+
+	script := `trap 'rm -f "$0"' EXIT; trap 'exit 1' HUP INT TERM; "$@"`
+	return slices.Concat([]string{"sh", "-c", script, file.Name()}, command), file.Name(), nil
+}
+
+// The marker stays if the shell gets killed, so this also gives up on stop.
+func waitForMarker(marker string, exited chan struct{}, stop <-chan struct{}) {
+	defer close(exited)
+	ticker := time.NewTicker(markerPollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := os.Stat(marker); os.IsNotExist(err) {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			os.Remove(marker)
+			return
+		}
+	}
+}
+
+func editorCommand(editor, path string, private bool) []string {
+	switch name := filepath.Base(editor); {
+	// swap, undo and history files can contain the text of private files
+	case private && (name == "vi" || name == "vim" || name == "nvim"):
+		return []string{editor, "-n", "-i", "NONE", "-c", "set noundofile nobackup nowritebackup", path}
+	default:
+		return []string{editor, path}
+	}
+}
+
+type TmuxLauncher struct{}
+
+func (l *TmuxLauncher) Name() string { return "tmux" }
+
+func (l *TmuxLauncher) Available() bool {
+	_, isInTmux := os.LookupEnv("TMUX")
+	return isInTmux
+}
+
+func (l *TmuxLauncher) Modes() []string { return []string{"popup", "window", "pane"} }
+
+func (l *TmuxLauncher) Waits(mode string) bool { return mode == "popup" }
+
+func (l *TmuxLauncher) Launch(command []string, title, mode string) error {
+	var args []string
+	switch mode {
+	case "window":
+		args = []string{"neww", "-n", title}
+	case "pane":
+		args = []string{"split-window", "-h"}
+	default:
+		args = []string{"display-popup", "-w", "100%", "-h", "100%", "-T", title, "-EE"}
+	}
+	return exec.Command("tmux", append(args, command...)...).Run()
+}
+
+type ZellijLauncher struct{}
+
+func (l *ZellijLauncher) Name() string { return "zellij" }
+
+func (l *ZellijLauncher) Available() bool {
+	_, isInZellij := os.LookupEnv("ZELLIJ")
+	return isInZellij
+}
+
+func (l *ZellijLauncher) Modes() []string { return []string{"floating", "pane"} }
+
+func (l *ZellijLauncher) Waits(mode string) bool { return false }
+
+func (l *ZellijLauncher) Launch(command []string, title, mode string) error {
+	args := []string{"run", "--close-on-exit", "--name", title}
+	if mode == "floating" {
+		args = append(args, "--floating")
+	}
+	return exec.Command("zellij", slices.Concat(args, []string{"--"}, command)...).Run()
+}
+
+type ScreenLauncher struct{}
+
+func (l *ScreenLauncher) Name() string { return "screen" }
+
+func (l *ScreenLauncher) Available() bool {
+	_, isInScreen := os.LookupEnv("STY")
+	return isInScreen
+}
+
+func (l *ScreenLauncher) Modes() []string { return []string{"window"} }
+
+func (l *ScreenLauncher) Waits(mode string) bool { return false }
+
+func (l *ScreenLauncher) Launch(command []string, title, mode string) error {
+	return exec.Command("screen", append([]string{"-t", title}, command...)...).Run()
+}
+
+// Needs "allow_remote_control" in kitty's config.
+type KittyLauncher struct{}
+
+func (l *KittyLauncher) Name() string { return "kitty" }
+
+func (l *KittyLauncher) Available() bool {
+	_, isInKitty := os.LookupEnv("KITTY_WINDOW_ID")
+	return isInKitty
+}
+
+func (l *KittyLauncher) Modes() []string { return []string{"overlay", "tab", "window", "os-window"} }
+
+func (l *KittyLauncher) Waits(mode string) bool { return false }
+
+func (l *KittyLauncher) Launch(command []string, title, mode string) error {
+	args := []string{"@", "launch", "--type=" + mode, "--title", title}
+	return exec.Command("kitty", append(args, command...)...).Run()
+}
+
+type WeztermLauncher struct{}
+
+func (l *WeztermLauncher) Name() string { return "wezterm" }
+
+func (l *WeztermLauncher) Available() bool {
+	_, isInWezterm := os.LookupEnv("WEZTERM_PANE")
+	return isInWezterm
+}
+
+func (l *WeztermLauncher) Modes() []string { return []string{"tab", "pane", "window"} }
+
+func (l *WeztermLauncher) Waits(mode string) bool { return false }
+
+func (l *WeztermLauncher) Launch(command []string, title, mode string) error {
+	var args []string
+	switch mode {
+	case "pane":
+		args = []string{"cli", "split-pane"}
+	case "window":
+		args = []string{"cli", "spawn", "--new-window"}
+	default:
+		args = []string{"cli", "spawn"}
 	}
+	return exec.Command("wezterm", slices.Concat(args, []string{"--"}, command)...).Run()
+}
+
+type SuspendLauncher struct {
+	screen t.Screen
+}
+
+func (l *SuspendLauncher) Name() string { return "suspend" }
+
+func (l *SuspendLauncher) Available() bool { return l.screen != nil }
+
+func (l *SuspendLauncher) Modes() []string { return []string{"foreground"} }
 
+func (l *SuspendLauncher) Waits(mode string) bool { return true }
+
+func (l *SuspendLauncher) Launch(command []string, title, mode string) error {
+	if err := l.screen.Suspend(); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 	err := cmd.Run()
-	log.Printf("opened entry for editing in %s: %s", editor, filepath)
+
+	if resumeErr := l.screen.Resume(); resumeErr != nil {
+		return errors.Join(err, resumeErr)
+	}
+	// the terminal was cleared, so everything needs to be drawn again
+	l.screen.Sync()
 
 	return err
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+func TestEditorCommand(t *testing.T) {
+	tests := []struct {
+		editor  string
+		private bool
+		want    []string
+	}{
+		{"nvim", false, []string{"nvim", "entry.md"}},
+		{"nano", true, []string{"nano", "entry.md"}},
+		{"/usr/bin/nvim", true, []string{"/usr/bin/nvim", "-n", "-i", "NONE", "-c", "set noundofile nobackup nowritebackup", "entry.md"}},
+		{"vim", true, []string{"vim", "-n", "-i", "NONE", "-c", "set noundofile nobackup nowritebackup", "entry.md"}},
+	}
+	for _, test := range tests {
+		got := editorCommand(test.editor, "entry.md", test.private)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("editorCommand(%q, %v) = %q, want %q", test.editor, test.private, got, test.want)
+		}
+	}
+}
+
+func TestNewEditor(tt *testing.T) {
+	tt.Setenv("TMUX", "")
+	os.Unsetenv("TMUX")
+	screen := t.NewSimulationScreen("")
+
+	editor, err := NewEditor("suspend", "", "", screen)
+	if err != nil || editor.Launcher.Name() != "suspend" || editor.Mode != "foreground" {
+		tt.Errorf("NewEditor(suspend) = %+v, %v", editor, err)
+	}
+
+	tests := []struct {
+		launcher, mode string
+		wantErr        string
+	}{
+		{"tmux", "", "tmux"},
+		{"notepad", "", "unknown editor launcher"},
+		{"suspend", "popup", "unknown mode"},
+	}
+	for _, test := range tests {
+		_, err := NewEditor(test.launcher, test.mode, "", screen)
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			tt.Errorf("NewEditor(%q, %q) error = %v, want it to mention %q", test.launcher, test.mode, err, test.wantErr)
+		}
+	}
+}
+
+func TestWaitForMarker(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	markerPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { markerPollInterval = time.Second })
+
+	command, marker, err := markExit([]string{"true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(marker) != dir {
+		t.Errorf("marker %s is not in the runtime dir", marker)
+	}
+
+	// the shell never runs, like when it gets killed, so only stopping ends
+	// the wait
+	exited, stop := make(chan struct{}), make(chan struct{})
+	go waitForMarker(marker, exited, stop)
+	select {
+	case <-exited:
+		t.Fatal("stopped waiting while the marker exists")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(stop)
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("still waiting after being stopped")
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("marker was not removed: %v", err)
+	}
+
+	// the shell removes the marker when the command exits
+	command, marker, _ = markExit([]string{"true"})
+	exited = make(chan struct{})
+	go waitForMarker(marker, exited, nil)
+	if err := exec.Command(command[0], command[1:]...).Run(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("still waiting after the command exited")
+	}
+}
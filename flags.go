@@ -2,23 +2,98 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"strings"
+	"time"
 )
 
 var Flags struct {
+	command     string
+	query       string
 	path        string
 	mntPath     string
 	idleTimeout string
+	autoLock    time.Duration
+	store       string
+	passFile    string
+	extPass     string
+	keyring     bool
+	readOnly    bool
+	profile     string
+	gcfsArgs    stringList
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+const (
+	StoreGocryptfs = "gocryptfs"
+	StorePlain     = "plain"
+	StoreVault     = "vault"
+)
+
+var Stores = []string{StoreGocryptfs, StorePlain, StoreVault}
+
+const (
+	CommandInit  = "init"
+	CommandQuery = "query"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage:")
+	fmt.Fprintln(out, "  journal [flags] [path]               Open the journal")
+	fmt.Fprintln(out, "  journal [flags] init [path]          Create a new journal")
+	fmt.Fprintln(out, "  journal [flags] query <expr> [path]  Print the dates of the entries that match a query")
+	fmt.Fprintln(out, "\nQueries combine tags, text, dates and operators, e.g.:")
+	fmt.Fprintln(out, "  @work -@travel after:2025-01-01 before:2025-06-30 \"standup\"")
+	fmt.Fprintln(out, "  (@gym OR @run) NOT lazy")
+	fmt.Fprintln(out, "\nThe path defaults to the JOURNAL_ENC_DIR env variable.\n\nFlags:")
+	flag.PrintDefaults()
 }
 
 func parseFlags() {
-	flag.StringVar(&Flags.mntPath, "m", "/tmp/journal", "The path to the directory where the journal will be mounted.")
+	flag.StringVar(&Flags.mntPath, "m", "", "The path to the directory where the journal will be mounted. Only the owner can have access to it. Defaults to a new private directory in $XDG_RUNTIME_DIR.")
 	flag.StringVar(&Flags.idleTimeout, "idle", "30m", "The journal will be unmounted after some time without any operations. Examples: 30s, 5m, 1h")
+	flag.DurationVar(&Flags.autoLock, "lock", 10*time.Minute, "The journal will be locked after some time without any key presses in the app, unless an entry is open in an editor. Use 0 to disable. Examples: 30s, 5m, 1h")
+	flag.StringVar(&Flags.store, "store", StoreGocryptfs, "How the journal is stored. One of: "+strings.Join(Stores, ", "))
+	flag.StringVar(&Flags.passFile, "passfile", "", "Read the password from the first line of a file.")
+	flag.StringVar(&Flags.extPass, "extpass", "", "Get the password from the output of a shell command. Example: \"pass show journal\"")
+	flag.BoolVar(&Flags.keyring, "keyring", false, "Get the password from the system keyring, using the Secret Service D-Bus API. The password must be stored with the attributes \"service journal account <path>\".")
+	flag.BoolVar(&Flags.readOnly, "ro", false, "Open the journal in read-only mode, which prevents creating, editing and deleting entries.")
+	flag.StringVar(&Flags.profile, "profile", "", "Use the settings of a profile in the config file.")
+	flag.Var(&Flags.gcfsArgs, "gocryptfs-arg", "An extra option for gocryptfs when mounting the journal, added after the ones in the config file. Can be repeated. Example: -gocryptfs-arg=-noprealloc")
+	flag.Usage = usage
 	flag.Parse()
 
-	Flags.path = strings.TrimSpace(flag.Arg(0))
+	args := flag.Args()
+	if len(args) > 0 && args[0] == CommandInit {
+		Flags.command = args[0]
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == CommandQuery {
+		if len(args) < 2 {
+			log.Fatal("missing query expression")
+		}
+		Flags.command = args[0]
+		Flags.query = args[1]
+		// queries never change the journal
+		Flags.readOnly = true
+		args = args[2:]
+	}
+
+	if len(args) > 0 {
+		Flags.path = strings.TrimSpace(args[0])
+	}
 	if len(Flags.path) == 0 {
 		path, hasEnv := os.LookupEnv("JOURNAL_ENC_DIR")
 		if hasEnv {
@@ -27,4 +102,16 @@ func parseFlags() {
 			log.Fatal("no path argument specified and the env variable is not set")
 		}
 	}
+
+	// without a home directory there is no config file, which is only a
+	// problem if a profile was selected
+	configFile, err := configPath()
+	if err == nil {
+		err = loadConfig(configFile, Flags.profile)
+	} else if len(Flags.profile) == 0 {
+		err = nil
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
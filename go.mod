@@ -6,7 +6,11 @@ require (
 	github.com/bbrks/wrap v2.3.0+incompatible
 	github.com/farmergreg/rfsnotify v0.0.0-20240825142021-55bd5f2910f6
 	github.com/gdamore/tcell/v2 v2.13.8
+	github.com/godbus/dbus/v5 v5.2.2
 	github.com/hashicorp/go-version v1.8.0
+	github.com/rivo/uniseg v0.4.7
+	golang.org/x/crypto v0.45.0
+	golang.org/x/term v0.37.0
 	gopkg.in/fsnotify.v1 v1.4.7
 )
 
@@ -14,9 +18,7 @@ require (
 	github.com/fsnotify/fsnotify v1.9.0 // indirect
 	github.com/gdamore/encoding v1.0.1 // indirect
 	github.com/lucasb-eyer/go-colorful v1.3.0 // indirect
-	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/stretchr/testify v1.11.1 // indirect
 	golang.org/x/sys v0.38.0 // indirect
-	golang.org/x/term v0.37.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
 )
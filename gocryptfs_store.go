@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-version"
+)
+
+var ErrIncorrectPassword = errors.New("Incorrect password")
+var ErrMountNotEmpty = errors.New("Mount point is not empty")
+var ErrCipherDirNotEmpty = errors.New("Directory for the new journal is not empty")
+var ErrWriteConfig = errors.New("Failed to write the journal's config file")
+var ErrMountNotPrivate = errors.New("Mount point can be accessed by other users")
+var ErrInvalidGocryptfsArg = errors.New("Invalid gocryptfs option")
+
+// gocryptfs -init prints the master key over two lines.
+var initMasterKeyPattern = regexp.MustCompile(`[0-9a-f]{8}(-\s*[0-9a-f]{8}){7}`)
+
+var gocryptfsValueOptions = map[string]bool{
+	"config": true, "ctlsock": true, "e": true, "exclude": true, "ew": true,
+	"exclude-wildcard": true, "exclude-from": true, "force_owner": true,
+	"fsname": true, "i": true, "idle": true, "ko": true, "longnamemax": true,
+	"o": true, "scryptn": true,
+}
+
+var gocryptfsForbiddenOptions = map[string]string{
+	"f":         "the app needs gocryptfs to run in the foreground",
+	"fg":        "the app needs gocryptfs to run in the foreground",
+	"notifypid": "the app uses it to know when the journal is mounted",
+	"extpass":   "the app passes the password to gocryptfs itself",
+	"passfile":  "the app passes the password to gocryptfs itself",
+	"masterkey": "the app passes the password to gocryptfs itself",
+	"fido2":     "the app passes the password to gocryptfs itself",
+	"zerokey":   "the app passes the password to gocryptfs itself",
+	"ro":        "use the app's -ro flag instead",
+	"i":         "use the app's -idle flag instead",
+	"idle":      "use the app's -idle flag instead",
+	"init":      "it is not a mount option",
+	"passwd":    "it is not a mount option",
+	"info":      "it is not a mount option",
+	"fsck":      "it is not a mount option",
+	"version":   "it is not a mount option",
+	"speed":     "it is not a mount option",
+	"h":         "it is not a mount option",
+	"help":      "it is not a mount option",
+	"hh":        "it is not a mount option",
+}
+
+type GocryptfsStore struct {
+	*dirFiles
+	isAutoMount bool
+	createdRoot bool
+	cipherPath  string
+	extraArgs   []string
+	idleTimeout string
+	readOnly    bool
+	command     *exec.Cmd
+	signals     chan os.Signal
+	// gocryptfs can exit at any time due to the idle timeout
+	isMounted    atomic.Bool
+	isUnmounting atomic.Bool
+	isSilent     atomic.Bool
+	exited       chan struct{}
+	onUnmount    func()
+}
+
+var _ LocalStore = (*GocryptfsStore)(nil)
+var _ InitStore = (*GocryptfsStore)(nil)
+var _ PasswordStore = (*GocryptfsStore)(nil)
+var _ RecoveryStore = (*GocryptfsStore)(nil)
+
+func NewGocryptfsStore(cipherPath, mountPath string, idleTimeout string, readOnly bool, extraArgs []string) *GocryptfsStore {
+	return &GocryptfsStore{
+		dirFiles:    newDirFiles(mountPath),
+		isAutoMount: len(mountPath) == 0,
+		cipherPath:  strings.TrimSuffix(cipherPath, "/"),
+		extraArgs:   extraArgs,
+		idleTimeout: idleTimeout,
+		readOnly:    readOnly,
+		command:     nil,
+		signals:     make(chan os.Signal, 1),
+		exited:      nil,
+		onUnmount:   nil,
+	}
+}
+
+func (s *GocryptfsStore) Mount(password string) error {
+	return s.mount(password)
+}
+
+func (s *GocryptfsStore) MountMasterKey(masterKey string) error {
+	masterKey, err := normalizeMasterKey(masterKey)
+	if err != nil {
+		return err
+	}
+
+	err = s.mount(masterKey, "-masterkey=stdin")
+	if err != nil {
+		return err
+	}
+
+	// gocryptfs cannot tell if the master key is wrong, but then it will fail
+	// to decrypt the files
+	if !s.canDecrypt() {
+		s.unmount(false)
+		return ErrInvalidMasterKey
+	}
+
+	return nil
+}
+
+func (s *GocryptfsStore) canDecrypt() bool {
+	cipherEntries, err := os.ReadDir(s.cipherPath)
+	if err != nil {
+		return false
+	}
+	numEncrypted := 0
+	for _, entry := range cipherEntries {
+		if !strings.HasPrefix(entry.Name(), "gocryptfs.") {
+			numEncrypted++
+		}
+	}
+	if numEncrypted == 0 {
+		return true
+	}
+
+	paths, err := s.List()
+	if err != nil || len(paths) == 0 {
+		return false
+	}
+	_, err = s.Read(paths[0])
+	return err == nil
+}
+
+func (s *GocryptfsStore) mount(secret string, options ...string) error {
+	if s.isMounted.Load() {
+		return errors.New("journal is already mounted")
+	}
+
+	err := s.prepareMountPoint()
+	if err != nil {
+		return err
+	}
+
+	args := []string{
+		"-fg",
+		"-notifypid",
+		fmt.Sprintf("%d", os.Getpid()),
+		"-idle",
+		s.idleTimeout,
+	}
+	if s.readOnly {
+		args = append(args, "-ro")
+	}
+	args = append(args, options...)
+	args = append(args, s.extraArgs...)
+	args = append(args, s.cipherPath, s.root)
+	s.command = exec.Command("gocryptfs", args...)
+
+	// for writing the password to the command over its STDIN
+	stdin, err := s.command.StdinPipe()
+	if err != nil {
+		s.removeMountPoint()
+		return err
+	}
+	defer stdin.Close()
+
+	// get signal from gocryptfs when it has mounted
+	signal.Notify(s.signals, syscall.SIGUSR1)
+	defer signal.Stop(s.signals)
+
+	err = s.command.Start()
+	if err != nil {
+		s.removeMountPoint()
+		return err
+	}
+
+	_, err = io.WriteString(stdin, secret+"\n")
+	if err != nil {
+		s.command.Process.Kill()
+		s.command.Wait()
+		s.removeMountPoint()
+		return err
+	}
+
+	// each mount gets its own channel, so that a previous mount's command
+	// can never be mistaken for this one
+	errorChan := make(chan error, 1)
+	go func() {
+		errorChan <- s.command.Wait()
+	}()
+
+	select {
+	// timeout, abort mission
+	case <-time.NewTimer(3 * time.Second).C:
+		s.command.Process.Kill()
+		<-errorChan
+		s.removeMountPoint()
+		return errors.New("timed out waiting for journal to mount")
+
+	// got error, command has exited
+	case err := <-errorChan:
+		s.removeMountPoint()
+		return gocryptfsError(err)
+
+	// got signal, has mounted successfully
+	case <-s.signals:
+		s.isMounted.Store(true)
+		s.isUnmounting.Store(false)
+		s.isSilent.Store(false)
+		s.exited = make(chan struct{})
+
+		// watch mounted path for fs events
+		s.startWatching()
+
+		// wait for the command to exit, either by us or due to the idle timeout
+		go func(exited chan struct{}) {
+			err := <-errorChan
+			if err != nil && !s.isUnmounting.Load() {
+				log.Printf("journal locked; %s", err.Error())
+			}
+			s.stopWatching()
+			s.removeMountPoint()
+			// only once the mount point is gone, so that the next mount
+			// cannot replace it before then
+			s.isMounted.Store(false)
+			if s.onUnmount != nil && !s.isSilent.Load() {
+				s.onUnmount()
+			}
+			close(exited)
+		}(s.exited)
+
+		return nil
+	}
+}
+
+func (s *GocryptfsStore) prepareMountPoint() error {
+	if s.isAutoMount {
+		dir, err := runtimeDir()
+		if err != nil {
+			return err
+		}
+		// MkdirTemp creates the directory with 0700 permissions
+		s.root, err = os.MkdirTemp(dir, "journal-")
+		s.createdRoot = err == nil
+		return err
+	}
+
+	info, err := os.Stat(s.root)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(s.root, 0700)
+		s.createdRoot = err == nil
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return errors.New("mount point is not a directory: " + s.root)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("%w: %s has permissions %04o, use `chmod 700` to fix it", ErrMountNotPrivate, s.root, perm)
+	}
+
+	return nil
+}
+
+func (s *GocryptfsStore) removeMountPoint() {
+	if !s.createdRoot {
+		return
+	}
+	err := os.Remove(s.root)
+	if err != nil {
+		log.Println(err)
+	}
+	s.createdRoot = false
+}
+
+func (s *GocryptfsStore) Unmount() error {
+	return s.unmount(true)
+}
+
+func (s *GocryptfsStore) unmount(notify bool) error {
+	if !s.isMounted.Load() || s.command == nil {
+		return nil
+	}
+
+	s.isSilent.Store(!notify)
+	s.isUnmounting.Store(true)
+	s.command.Process.Signal(syscall.SIGTERM)
+
+	select {
+	case <-s.exited:
+	case <-time.After(3 * time.Second):
+		log.Println("timed out waiting for gocryptfs to exit")
+	}
+
+	return nil
+}
+
+func (s *GocryptfsStore) IsInitialized() bool {
+	configFile := s.cipherPath + "/gocryptfs.conf"
+	if args := s.configArgs(); len(args) > 0 {
+		configFile = args[1]
+	}
+	_, err := os.Stat(configFile)
+	return err == nil
+}
+
+// The commands that set up the journal and change its password need it too.
+func (s *GocryptfsStore) configArgs() []string {
+	configArgs := []string{}
+	for i := 0; i < len(s.extraArgs); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(s.extraArgs[i], "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if !hasValue && i+1 < len(s.extraArgs) {
+			i++
+			value = s.extraArgs[i]
+		}
+		configArgs = []string{"-config", value}
+	}
+	return configArgs
+}
+
+func (s *GocryptfsStore) Init(password string) (string, error) {
+	if s.IsInitialized() {
+		return "", errors.New("journal has already been set up")
+	}
+
+	err := os.MkdirAll(s.cipherPath, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	args := append([]string{"-init"}, s.configArgs()...)
+	cmd := exec.Command("gocryptfs", append(args, s.cipherPath)...)
+	cmd.Stdin = strings.NewReader(password + "\n")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if err, isExit := err.(*exec.ExitError); isExit && err.ExitCode() == 6 {
+			return "", ErrCipherDirNotEmpty
+		}
+		return "", fmt.Errorf("gocryptfs -init failed: %w\n%s", err, bytes.TrimSpace(output))
+	}
+
+	masterKey, err := findMasterKey(output)
+	if err != nil {
+		return "", errors.New("journal was created, but gocryptfs did not output the master key")
+	}
+
+	return masterKey, nil
+}
+
+func findMasterKey(output []byte) (string, error) {
+	match := initMasterKeyPattern.Find(output)
+	if match == nil {
+		return "", ErrInvalidMasterKey
+	}
+	return normalizeMasterKey(string(match))
+}
+
+func (s *GocryptfsStore) ChangePassword(oldPassword, newPassword string) error {
+	args := append([]string{"-passwd"}, s.configArgs()...)
+	cmd := exec.Command("gocryptfs", append(args, s.cipherPath)...)
+	cmd.Stdin = strings.NewReader(oldPassword + "\n" + newPassword + "\n")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		err = gocryptfsError(err)
+		if _, isExit := err.(*exec.ExitError); isExit {
+			return fmt.Errorf("gocryptfs -passwd failed: %w\n%s", err, bytes.TrimSpace(output))
+		}
+	}
+	return err
+}
+
+func (s *GocryptfsStore) ResetPassword(masterKey, newPassword string) error {
+	masterKey, err := normalizeMasterKey(masterKey)
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"-passwd", "-masterkey=stdin"}, s.configArgs()...)
+	cmd := exec.Command("gocryptfs", append(args, s.cipherPath)...)
+	cmd.Stdin = strings.NewReader(masterKey + "\n" + newPassword + "\n")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		err = gocryptfsError(err)
+		if _, isExit := err.(*exec.ExitError); isExit {
+			return fmt.Errorf("gocryptfs -passwd failed: %w\n%s", err, bytes.TrimSpace(output))
+		}
+	}
+	return err
+}
+
+func (s *GocryptfsStore) IsMounted() bool {
+	return s.isMounted.Load()
+}
+
+func (s *GocryptfsStore) OnUnmount(fn func()) {
+	s.onUnmount = fn
+}
+
+func gocryptfsError(err error) error {
+	if err, isExit := err.(*exec.ExitError); isExit {
+		switch err.ExitCode() {
+		case 10:
+			return ErrMountNotEmpty
+		case 12:
+			return ErrIncorrectPassword
+		case 14:
+			return ErrInvalidMasterKey
+		case 22:
+			return ErrEmptyPassword
+		case 23:
+			return ErrWriteConfig
+		}
+	}
+	return err
+}
+
+func validateGocryptfsArgs(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" || arg == "--" {
+			return fmt.Errorf("%w %q: not an option", ErrInvalidGocryptfsArg, arg)
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if reason, isForbidden := gocryptfsForbiddenOptions[name]; isForbidden {
+			return fmt.Errorf("%w %q: %s", ErrInvalidGocryptfsArg, arg, reason)
+		}
+
+		if !gocryptfsValueOptions[name] || hasValue {
+			if name == "o" {
+				if err := validateMountOptions(value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if i+1 >= len(args) {
+			return fmt.Errorf("%w %q: missing value", ErrInvalidGocryptfsArg, arg)
+		}
+		i++
+		if name == "o" {
+			if err := validateMountOptions(args[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// gocryptfs treats the options of "-o" like its own.
+func validateMountOptions(options string) error {
+	for _, option := range strings.Split(options, ",") {
+		name, _, _ := strings.Cut(option, "=")
+		if reason, isForbidden := gocryptfsForbiddenOptions[name]; isForbidden {
+			return fmt.Errorf("%w \"-o %s\": %s", ErrInvalidGocryptfsArg, option, reason)
+		}
+	}
+	return nil
+}
+
+func checkGCFSVersion(minVersion string) error {
+	cmd := exec.Command("gocryptfs", "-version")
+	output, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(string(output), ";")
+	if len(parts) < 1 {
+		return errors.New("unexpected output from 'gocryptfs -version': " + string(output))
+	}
+
+	versionStr, found := strings.CutPrefix(parts[0], "gocryptfs v")
+	if !found {
+		return errors.New("invalid gocryptfs version: " + parts[0])
+	}
+
+	actualVersion, err := version.NewVersion(versionStr)
+	if err != nil {
+		return err
+	}
+
+	constraint, _ := version.NewConstraint(">= " + minVersion)
+	if !constraint.Check(actualVersion) {
+		return errors.New("gocryptfs version " + minVersion + " is required, found v" + versionStr)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFindMasterKey(t *testing.T) {
+	output := []byte(`Choose a password for protecting your files.
+Repeat:
+
+Your master key is:
+
+    6f717d8b-6b5f8e8a-fd0aa206-5e6e17a2-
+    6e7c7b3d-ab4b2e2d-bc7e8dcd-3c3a5bd9
+
+If the gocryptfs.conf file becomes corrupted or you ever forget your password,
+there is only one hope for recovery: The master key. Print it to a piece of
+paper and store it in a drawer. This message is only printed once.
+The gocryptfs filesystem has been created successfully.
+`)
+
+	masterKey, err := findMasterKey(output)
+	want := "6f717d8b-6b5f8e8a-fd0aa206-5e6e17a2-6e7c7b3d-ab4b2e2d-bc7e8dcd-3c3a5bd9"
+	if err != nil || masterKey != want {
+		t.Errorf("findMasterKey() = %q, %v, want %q", masterKey, err, want)
+	}
+
+	if _, err := findMasterKey([]byte("The gocryptfs filesystem has been created successfully.")); err == nil {
+		t.Error("findMasterKey() found a key in output without one")
+	}
+}
+
+func TestValidateGocryptfsArgs(t *testing.T) {
+	valid := [][]string{
+		{},
+		{"-noprealloc"},
+		{"-config", "/path/to/journal.conf", "-allow_other"},
+		{"--config=/path/to/journal.conf"},
+		{"-o", "allow_other,noexec"},
+	}
+	for _, args := range valid {
+		if err := validateGocryptfsArgs(args); err != nil {
+			t.Errorf("validateGocryptfsArgs(%q) = %v", args, err)
+		}
+	}
+
+	invalid := [][]string{
+		{"-fg"},
+		{"-passfile", "/path/to/password"},
+		{"--extpass=pass show journal"},
+		{"-ro"},
+		{"-idle", "5m"},
+		{"-idle=5m"},
+		{"-i", "5m"},
+		{"-o", "allow_other,ro"},
+		{"-config"},
+		{"/path/to/cipher"},
+	}
+	for _, args := range invalid {
+		if err := validateGocryptfsArgs(args); !errors.Is(err, ErrInvalidGocryptfsArg) {
+			t.Errorf("validateGocryptfsArgs(%q) error = %v, want %v", args, err, ErrInvalidGocryptfsArg)
+		}
+	}
+}
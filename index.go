@@ -0,0 +1,224 @@
+package main
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mecha/journal/utils"
+)
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// Updated by the store's events, which may arrive from another goroutine.
+type Index struct {
+	mu      sync.RWMutex
+	entries map[time.Time]string
+	tags    map[string]map[time.Time]bool
+	words   map[string]map[time.Time]bool
+}
+
+func NewIndex() *Index {
+	return &Index{
+		entries: map[time.Time]string{},
+		tags:    map[string]map[time.Time]bool{},
+		words:   map[string]map[time.Time]bool{},
+	}
+}
+
+func (idx *Index) clear() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	clear(idx.entries)
+	clear(idx.tags)
+	clear(idx.words)
+}
+
+func (idx *Index) update(date time.Time, content string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(date)
+	idx.entries[date] = content
+
+	for _, tag := range tagPattern.FindAllString(content, -1) {
+		addRef(idx.tags, tag, date)
+	}
+	for _, word := range wordPattern.FindAllString(content, -1) {
+		addRef(idx.words, strings.ToLower(word), date)
+	}
+}
+
+func (idx *Index) remove(date time.Time) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(date)
+}
+
+func (idx *Index) removeLocked(date time.Time) {
+	content, has := idx.entries[date]
+	if !has {
+		return
+	}
+	delete(idx.entries, date)
+
+	for _, tag := range tagPattern.FindAllString(content, -1) {
+		removeRef(idx.tags, tag, date)
+	}
+	for _, word := range wordPattern.FindAllString(content, -1) {
+		removeRef(idx.words, strings.ToLower(word), date)
+	}
+}
+
+func (idx *Index) Content(date time.Time) string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.entries[date]
+}
+
+func (idx *Index) Tags() []TagInfo {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	dates := map[string]map[time.Time]bool{}
+	for tag, tagDates := range idx.tags {
+		for _, name := range tagAncestry(tag) {
+			for date := range tagDates {
+				addRef(dates, name, date)
+			}
+		}
+	}
+
+	tags := make([]TagInfo, 0, len(dates))
+	for _, name := range slices.Sorted(maps.Keys(dates)) {
+		info := TagInfo{Name: name, Count: len(dates[name])}
+		for date := range dates[name] {
+			if date.After(info.LastUsed) {
+				info.LastUsed = date
+			}
+		}
+		tags = append(tags, info)
+	}
+	return tags
+}
+
+func (idx *Index) TagDates(tag string) []time.Time {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return sortedDates(idx.tagDatesLocked(tag))
+}
+
+func (idx *Index) tagDatesLocked(tag string) map[time.Time]bool {
+	dates := map[time.Time]bool{}
+	for name, tagDates := range idx.tags {
+		if name == tag || strings.HasPrefix(name, tag+"/") {
+			maps.Copy(dates, tagDates)
+		}
+	}
+	return dates
+}
+
+func (idx *Index) RelatedTags(tag string) []TagInfo {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	dates := idx.tagDatesLocked(tag)
+	related := []TagInfo{}
+	for name, tagDates := range idx.tags {
+		if name == tag || strings.HasPrefix(name, tag+"/") || strings.HasPrefix(tag, name+"/") {
+			continue
+		}
+		info := TagInfo{Name: name}
+		for date := range tagDates {
+			if !dates[date] {
+				continue
+			}
+			info.Count++
+			if date.After(info.LastUsed) {
+				info.LastUsed = date
+			}
+		}
+		if info.Count > 0 {
+			related = append(related, info)
+		}
+	}
+
+	slices.SortFunc(related, func(a, b TagInfo) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return related
+}
+
+func tagAncestry(tag string) []string {
+	names := []string{}
+	for i, r := range tag {
+		if r == '/' {
+			names = append(names, tag[:i])
+		}
+	}
+	return append(names, tag)
+}
+
+func (idx *Index) Search(query string) []SearchResult {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var candidates map[time.Time]bool
+	for _, queryWord := range wordPattern.FindAllString(strings.ToLower(query), -1) {
+		matches := map[time.Time]bool{}
+		for word, dates := range idx.words {
+			if strings.Contains(word, queryWord) {
+				maps.Copy(matches, dates)
+			}
+		}
+		if candidates != nil {
+			maps.DeleteFunc(candidates, func(date time.Time, _ bool) bool { return !matches[date] })
+		} else {
+			candidates = matches
+		}
+	}
+	if candidates == nil {
+		candidates = map[time.Time]bool{}
+		for date := range idx.entries {
+			candidates[date] = true
+		}
+	}
+
+	results := []SearchResult{}
+	for _, date := range sortedDates(candidates) {
+		for i, line := range strings.Split(idx.entries[date], "\n") {
+			if len(utils.IndexAllFold(line, query)) > 0 {
+				results = append(results, SearchResult{date, i, line})
+			}
+		}
+	}
+	return results
+}
+
+func addRef(refs map[string]map[time.Time]bool, key string, date time.Time) {
+	if refs[key] == nil {
+		refs[key] = map[time.Time]bool{}
+	}
+	refs[key][date] = true
+}
+
+func removeRef(refs map[string]map[time.Time]bool, key string, date time.Time) {
+	delete(refs[key], date)
+	if len(refs[key]) == 0 {
+		delete(refs, key)
+	}
+}
+
+func sortedDates(dates map[time.Time]bool) []time.Time {
+	return slices.SortedFunc(maps.Keys(dates), func(a, b time.Time) int { return a.Compare(b) })
+}
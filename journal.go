@@ -1,207 +1,177 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"log"
-	"maps"
 	"os"
-	"os/exec"
-	"os/signal"
-	"path"
+	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
-	"syscall"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/farmergreg/rfsnotify"
-	"github.com/hashicorp/go-version"
 	"github.com/mecha/journal/utils"
-	"gopkg.in/fsnotify.v1"
 )
 
-var ErrIncorrectPassword = errors.New("Incorrect password")
-var ErrMountNotEmpty = errors.New("Mount point is not empty")
+var tagPattern = regexp.MustCompile(`@[^\W]+(/[^\W]+)*`)
+
+var ErrReadOnly = errors.New("journal is read-only")
+var ErrNoExternalEditor = errors.New("entries of this journal can only be edited inside the app")
 
 type Journal struct {
-	cipherPath  string
-	mountPath   string
-	idleTimeout string
-	command     *exec.Cmd
-	signals     chan os.Signal
-	isMounted   bool
-	errorChan   chan error
-	onUnmount   func()
-	onFSEvent   func(ev fsnotify.Event)
-	watcher     *rfsnotify.RWatcher
-}
-
-func NewJournal(cipherPath, mountPath string, idleTimeout string) (*Journal, error) {
+	store     Store
+	index     *Index
+	readOnly  bool
+	onUnmount func()
+	onFSEvent func(ev StoreEvent)
+	// nil when there is no app
+	editor     *Editor
+	stageEdits bool
+	// changes are reported from another goroutine, so these are guarded
+	sessions   []*EditSession
+	unmounted  chan struct{}
+	sessionsMu sync.Mutex
+	onConflict func(conflict Conflict)
+	// undoing a mount that failed to load is not reported as locking
+	isAborting atomic.Bool
+}
+
+func NewJournal(store Store, readOnly bool) *Journal {
 	journal := &Journal{
-		cipherPath:  strings.TrimSuffix(cipherPath, "/"),
-		mountPath:   strings.TrimSuffix(mountPath, "/"),
-		idleTimeout: idleTimeout,
-		command:     nil,
-		signals:     make(chan os.Signal, 1),
-		isMounted:   false,
-		errorChan:   make(chan error),
-		onUnmount:   nil,
-		onFSEvent:   nil,
-	}
-
-	watcher, err := rfsnotify.NewWatcher()
-	if err != nil {
-		return journal, err
-	}
-	journal.watcher = watcher
+		store:     store,
+		index:     NewIndex(),
+		readOnly:  readOnly,
+		onUnmount: nil,
+		onFSEvent: nil,
+		editor:    nil,
+		sessions:  []*EditSession{},
+		unmounted: make(chan struct{}),
+	}
+
+	store.Watch(func(ev StoreEvent) {
+		journal.reindex(ev.Path)
+		if journal.onFSEvent != nil {
+			journal.onFSEvent(ev)
+		}
+	})
+	store.OnUnmount(func() {
+		journal.index.clear()
+		journal.sessionsMu.Lock()
+		journal.sessions = []*EditSession{}
+		close(journal.unmounted)
+		journal.unmounted = make(chan struct{})
+		journal.sessionsMu.Unlock()
+		if journal.onUnmount != nil && !journal.isAborting.Load() {
+			journal.onUnmount()
+		}
+	})
 
-	return journal, nil
+	return journal
 }
 
 func (j *Journal) Mount(password string) error {
-	if j.isMounted {
-		return errors.New("journal is already mounted")
-	}
-
-	os.MkdirAll(j.mountPath, 0755)
-
-	j.command = exec.Command(
-		"gocryptfs",
-		"-fg",
-		"-notifypid",
-		fmt.Sprintf("%d", os.Getpid()),
-		"-idle",
-		j.idleTimeout,
-		j.cipherPath,
-		j.mountPath,
-	)
-
-	// for writing the password to the command over its STDIN
-	stdin, err := j.command.StdinPipe()
+	err := j.store.Mount(password)
 	if err != nil {
 		return err
 	}
-	defer stdin.Close()
+	return j.loadIndex()
+}
 
-	// get signal from gocryptfs when it has mounted
-	signal.Notify(j.signals, syscall.SIGUSR1)
-	defer signal.Stop(j.signals)
+func (j *Journal) Unmount() error {
+	return j.store.Unmount()
+}
 
-	err = j.command.Start()
-	if err != nil {
-		return err
-	}
+func (j *Journal) IsMounted() bool {
+	return j.store.IsMounted()
+}
 
-	_, err = io.WriteString(stdin, password+"\n")
-	if err != nil {
-		return err
-	}
+func (j *Journal) IsReadOnly() bool {
+	return j.readOnly
+}
 
-	go func() {
-		j.errorChan <- j.command.Wait()
-	}()
+func (j *Journal) NeedsSetup() bool {
+	store, canInit := j.store.(InitStore)
+	return canInit && !store.IsInitialized()
+}
 
-	select {
-	// timeout, abort mission
-	case <-time.NewTimer(3 * time.Second).C:
-		return errors.New("timed out waiting for journal to mount")
-
-	// got error, command has exited
-	case err := <-j.errorChan:
-		switch err := err.(type) {
-		case *exec.ExitError:
-			switch err.ExitCode() {
-			case 12:
-				return ErrIncorrectPassword
-			case 10:
-				return ErrMountNotEmpty
-			}
-		}
-		return err
+func (j *Journal) Init(password string) (string, error) {
+	store, canInit := j.store.(InitStore)
+	if !canInit {
+		return "", errors.New("this kind of journal does not need to be set up")
+	}
+	return store.Init(password)
+}
 
-	// got signal, has mounted successfully
-	case <-j.signals:
-		j.isMounted = true
+func (j *Journal) CanChangePassword() bool {
+	_, canChange := j.store.(PasswordStore)
+	return canChange
+}
 
-		// watch mounted path for fs events
-		err := j.watcher.AddRecursive(j.mountPath)
-		if err != nil {
-			log.Println(err)
-		}
-		go j.handleWatcherEvents()
+func (j *Journal) ChangePassword(oldPassword, newPassword string) error {
+	store, canChange := j.store.(PasswordStore)
+	if !canChange {
+		return errors.New("this kind of journal does not have a password")
+	}
+	if len(newPassword) == 0 {
+		return ErrEmptyPassword
+	}
+	return store.ChangePassword(oldPassword, newPassword)
+}
 
-		// listen for errors from the command to unmount
-		go func() {
-			err := <-j.errorChan
-			if err != nil {
-				log.Printf("journal locked; %s", err.Error())
-			}
-			j.isMounted = false
-			j.watcher.Close()
-			if j.onUnmount != nil {
-				j.onUnmount()
-			}
-			j.errorChan <- err
-		}()
+func (j *Journal) CanRecover() bool {
+	_, canRecover := j.store.(RecoveryStore)
+	return canRecover
+}
 
-		return nil
+func (j *Journal) MountMasterKey(masterKey string) error {
+	store, canRecover := j.store.(RecoveryStore)
+	if !canRecover {
+		return errors.New("this kind of journal does not have a master key")
 	}
+	err := store.MountMasterKey(masterKey)
+	if err != nil {
+		return err
+	}
+	return j.loadIndex()
 }
 
-func (j *Journal) handleWatcherEvents() {
-	for {
-		select {
-		case ev, ok := <-j.watcher.Events:
-			if !ok {
-				return
-			}
-			if j.onFSEvent != nil {
-				j.onFSEvent(ev)
-			}
-		case err, ok := <-j.watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Println(err)
-		}
+// The journal is never unlocked without an index.
+func (j *Journal) loadIndex() error {
+	err := j.buildIndex()
+	if err != nil {
+		j.isAborting.Store(true)
+		j.store.Unmount()
+		j.isAborting.Store(false)
+		return fmt.Errorf("failed to load the journal: %w", err)
 	}
+	return nil
 }
 
-func (j *Journal) Unmount() error {
-	if !j.isMounted || j.command == nil {
-		return nil
+func (j *Journal) ResetPassword(masterKey, newPassword string) error {
+	store, canRecover := j.store.(RecoveryStore)
+	if !canRecover {
+		return errors.New("this kind of journal does not have a master key")
 	}
-
-	j.command.Process.Signal(syscall.SIGTERM)
-	j.watcher.Close()
-
-	select {
-	case err := <-j.errorChan:
-		if err != nil && j.command.ProcessState.ExitCode() != 15 {
-			log.Println(err)
-		}
-	case <-time.After(3 * time.Second):
-		log.Println("timed out waiting for gocryptfs to exit")
+	if len(newPassword) == 0 {
+		return ErrEmptyPassword
 	}
-
-	return nil
+	return store.ResetPassword(masterKey, newPassword)
 }
 
 func (j *Journal) EntryPath(date time.Time) string {
 	day, month, year := date.Day(), int(date.Month()), date.Year()
-	return fmt.Sprintf("%s/%02d/%02d/%02d.md", j.mountPath, year, month, day)
+	return fmt.Sprintf("%02d/%02d/%02d.md", year, month, day)
 }
 
 func (j *Journal) HasEntry(date time.Time) (bool, error) {
-	if !j.isMounted {
+	if !j.IsMounted() {
 		return false, nil
 	}
 
-	filepath := j.EntryPath(date)
-	_, err := os.Stat(filepath)
+	_, err := j.store.Stat(j.EntryPath(date))
 	if os.IsNotExist(err) {
 		return false, nil
 	}
@@ -212,12 +182,11 @@ func (j *Journal) HasEntry(date time.Time) (bool, error) {
 }
 
 func (j *Journal) GetEntry(date time.Time) (string, bool, error) {
-	if !j.isMounted {
+	if !j.IsMounted() {
 		return "", false, nil
 	}
 
-	filepath := j.EntryPath(date)
-	content, err := os.ReadFile(filepath)
+	content, err := j.store.Read(j.EntryPath(date))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return "", false, nil
@@ -229,68 +198,159 @@ func (j *Journal) GetEntry(date time.Time) (string, bool, error) {
 	return string(content), true, nil
 }
 
-func (j *Journal) CreateEntry(date time.Time) (string, error) {
-	if !j.isMounted {
+func (j *Journal) CreateEntry(date time.Time, template string) (string, error) {
+	if !j.IsMounted() {
 		return "", errors.New("journal is not mounted")
 	}
+	if j.readOnly {
+		return "", fmt.Errorf("cannot create entry, %w", ErrReadOnly)
+	}
 
-	filepath := j.EntryPath(date)
-	dirpath := path.Dir(filepath)
-
-	err := os.MkdirAll(dirpath, 0740)
+	content, err := j.NewEntryContent(date, template)
 	if err != nil {
 		return "", err
 	}
 
-	err = j.watcher.Add(dirpath)
-	if err != nil {
-		log.Println(err)
-	}
+	path := j.EntryPath(date)
+	err = j.store.Write(path, []byte(content))
+	return path, err
+}
 
-	file, err := os.Create(filepath)
-	if err != nil {
-		return "", err
+func (j *Journal) NewEntryContent(date time.Time, template string) (string, error) {
+	if len(template) == 0 {
+		templates, err := j.Templates(date)
+		if err != nil {
+			return "", err
+		}
+		if len(templates) == 0 {
+			return "# " + date.Format("Mon - 02 Jan 2006") + "\n\n", nil
+		}
+		template = templates[0]
 	}
-	defer file.Close()
 
-	title := date.Format("Mon - 02 Jan 2006")
-	_, err = file.WriteString("# " + title + "\n\n")
-	if err != nil {
-		return "", err
-	}
+	return j.renderTemplate(template, date)
+}
 
-	err = os.Chmod(filepath, 0740)
-	return filepath, err
+func (j *Journal) WriteEntry(date time.Time, content string) error {
+	if !j.IsMounted() {
+		return errors.New("journal is not mounted")
+	}
+	if j.readOnly {
+		return fmt.Errorf("cannot write entry, %w", ErrReadOnly)
+	}
+	return j.store.Write(j.EntryPath(date), []byte(content))
 }
 
-func (j *Journal) EditEntry(date time.Time, window bool) error {
-	if !j.isMounted {
+func (j *Journal) EditEntry(date time.Time, mode string) error {
+	if !j.IsMounted() {
 		return errors.New("journal is not mounted")
 	}
+	if j.readOnly {
+		return fmt.Errorf("cannot edit entry, %w", ErrReadOnly)
+	}
+	if !j.CanEditExternally() {
+		return ErrNoExternalEditor
+	}
+	if j.editor == nil {
+		return errors.New("cannot edit entry without an editor")
+	}
 
-	filepath := j.EntryPath(date)
-	if _, err := os.Stat(filepath); os.IsNotExist(err) {
-		_, err := j.CreateEntry(date)
+	path := j.EntryPath(date)
+	has, err := j.HasEntry(date)
+	if err != nil {
+		return err
+	}
+	if !has {
+		_, err := j.CreateEntry(date, "")
 		if err != nil {
 			return err
 		}
-		log.Printf("created new entry: %s", filepath)
+		log.Printf("created new entry: %s", path)
 	}
 
 	title := date.Format("02 Jan 2006")
-	err := openEditor(filepath, title, window)
 
-	return err
+	store, isLocal := j.store.(LocalStore)
+	if !isLocal {
+		return j.editStaged(date, title, mode)
+	}
+
+	session := j.BeginEdit(date)
+	j.sessionsMu.Lock()
+	unmounted := j.unmounted
+	j.sessionsMu.Unlock()
+	exited, err := j.editor.Open(store.LocalPath(path), title, mode, false, false, unmounted)
+	if err != nil {
+		j.EndEdit(session)
+		return err
+	}
+
+	// editors that do not wait stay open after this returns
+	select {
+	case <-exited:
+		j.EndEdit(session)
+	default:
+		go func() {
+			<-exited
+			j.EndEdit(session)
+		}()
+	}
+	return nil
+}
+
+// Copies of entries for the editor are not encrypted, so they are opt-in.
+func (j *Journal) CanEditExternally() bool {
+	_, isLocal := j.store.(LocalStore)
+	return isLocal || j.stageEdits
+}
+
+// The editor needs a file, so the entry is copied to a private in-memory
+// directory that is removed afterwards.
+func (j *Journal) editStaged(date time.Time, title string, mode string) error {
+	memDir, err := runtimeDir()
+	if err != nil {
+		return err
+	}
+
+	session := j.BeginEdit(date)
+	defer j.EndEdit(session)
+
+	// MkdirTemp creates the directory with 0700 permissions
+	dir, err := os.MkdirTemp(memDir, fmt.Sprintf("%s%d-", stagingDirPrefix, os.Getpid()))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, date.Format("2006-01-02")+".md")
+	err = os.WriteFile(path, []byte(session.Base), 0600)
+	if err != nil {
+		return err
+	}
+
+	// we need to wait for the editor to exit before writing the file back
+	_, err = j.editor.Open(path, title, mode, true, true, nil)
+	if err != nil {
+		return err
+	}
+
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if string(edited) == session.Base {
+		return nil
+	}
+
+	return j.SaveEdit(session, string(edited))
 }
 
 func (j *Journal) GetEntryAtPath(path string) (time.Time, error) {
-	if !strings.HasPrefix(path, j.mountPath) {
+	dateStr, isEntry := strings.CutSuffix(path, ".md")
+	if !isEntry {
 		return time.Time{}, errors.New("not a path to a journal entry")
 	}
 
-	relpath := path[len(j.mountPath):]
-	dateStr := strings.TrimSuffix(strings.TrimPrefix(relpath, "/"), ".md")
-
 	date, err := utils.ParseYearMonthDay(dateStr)
 	if err != nil {
 		return date, err
@@ -299,86 +359,193 @@ func (j *Journal) GetEntryAtPath(path string) (time.Time, error) {
 }
 
 func (j *Journal) DeleteEntry(date time.Time) error {
-	path := j.EntryPath(date)
-	err := os.Remove(path)
-	return err
+	if j.readOnly {
+		return fmt.Errorf("cannot delete entry, %w", ErrReadOnly)
+	}
+	return j.store.Delete(j.EntryPath(date))
 }
 
-func (j *Journal) Tags() ([]string, error) {
-	if !j.isMounted {
-		return []string{}, errors.New("journal is not mounted")
+func (j *Journal) Entries() ([]time.Time, error) {
+	if !j.IsMounted() {
+		return []time.Time{}, errors.New("journal is not mounted")
 	}
 
-	cmd := exec.Command("rg", "--only-matching", "--no-filename", "--no-line-number", "@[^\\W]+", j.mountPath)
-	cmd.Stderr = os.Stderr
-	output, err := cmd.Output()
+	paths, err := j.store.List()
 	if err != nil {
-		return []string{}, fmt.Errorf("rg error: %w", err)
+		return []time.Time{}, err
 	}
 
-	tags := map[string]bool{}
-	scanner := bufio.NewScanner(bytes.NewBuffer(output))
-	for scanner.Scan() {
-		tags[scanner.Text()] = true
+	entries := []time.Time{}
+	for _, path := range paths {
+		date, err := j.GetEntryAtPath(path)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, date)
 	}
+	slices.SortFunc(entries, func(a, b time.Time) int { return a.Compare(b) })
 
-	return slices.Collect(maps.Keys(tags)), nil
+	return entries, nil
 }
 
-func (j *Journal) SearchTag(tag string) ([]time.Time, error) {
-	if !j.isMounted {
-		return []time.Time{}, errors.New("journal is not mounted")
-	}
+type SearchResult struct {
+	Date time.Time
+	Line int
+	Text string
+}
+
+func (j *Journal) buildIndex() error {
+	j.index.clear()
 
-	cmd := exec.Command("rg", "-l", "-w", tag, j.mountPath)
-	cmd.Stderr = os.Stderr
-	output, err := cmd.Output()
+	entries, err := j.Entries()
 	if err != nil {
-		return []time.Time{}, fmt.Errorf("rg error: %w", err)
+		return err
 	}
-
-	fileMap := map[time.Time]bool{}
-	scanner := bufio.NewScanner(bytes.NewBuffer(output))
-	for scanner.Scan() {
-		date, err := j.GetEntryAtPath(scanner.Text())
+	for _, date := range entries {
+		content, err := j.store.Read(j.EntryPath(date))
 		if err != nil {
-			continue
+			return err
 		}
-		fileMap[date] = true
+		j.index.update(date, string(content))
 	}
+	return nil
+}
 
-	entries := slices.Collect(maps.Keys(fileMap))
-	slices.SortFunc(entries, func(a, b time.Time) int { return a.Compare(b) })
+// Files are read again even for removal events, since editors often save
+// files by replacing them.
+func (j *Journal) reindex(path string) {
+	date, err := j.GetEntryAtPath(path)
+	if err != nil {
+		return
+	}
 
-	return entries, nil
+	before := j.index.Content(date)
+	content, err := j.store.Read(path)
+	switch {
+	case err == nil:
+		j.index.update(date, string(content))
+		j.checkEdit(date, before, string(content))
+	case os.IsNotExist(err):
+		j.index.remove(date)
+	default:
+		log.Println("failed to index entry; ", err)
+	}
 }
 
-func checkGCFSVersion(minVersion string) error {
-	cmd := exec.Command("gocryptfs", "-version")
-	output, err := cmd.Output()
+func (j *Journal) Query(query Query) ([]time.Time, error) {
+	if !j.IsMounted() {
+		return []time.Time{}, errors.New("journal is not mounted")
+	}
+
+	entries, err := j.Entries()
 	if err != nil {
-		return err
+		return []time.Time{}, err
+	}
+	all := dateSet{}
+	for _, date := range entries {
+		all[date] = true
+	}
+
+	matches, err := query.eval(j, all)
+	if err != nil {
+		return []time.Time{}, err
+	}
+	return sortedDates(matches), nil
+}
+
+func (j *Journal) Search(query Query) ([]SearchResult, error) {
+	dates, err := j.Query(query)
+	if err != nil {
+		return []SearchResult{}, err
+	}
+
+	terms := query.terms()
+	results := []SearchResult{}
+	for _, date := range dates {
+		lines := strings.Split(j.index.Content(date), "\n")
+		found := false
+		for i, line := range lines {
+			if slices.ContainsFunc(terms, func(term string) bool { return len(utils.IndexAllFold(line, term)) > 0 }) {
+				results = append(results, SearchResult{date, i, line})
+				found = true
+			}
+		}
+		if !found {
+			results = append(results, SearchResult{date, 0, lines[0]})
+		}
+	}
+	return results, nil
+}
+
+type TagInfo struct {
+	Name string
+	// the counts of parent tags include the entries of their descendants
+	Count    int
+	LastUsed time.Time
+}
+
+func (j *Journal) Tags() ([]TagInfo, error) {
+	if !j.IsMounted() {
+		return []TagInfo{}, errors.New("journal is not mounted")
 	}
+	return j.index.Tags(), nil
+}
 
-	parts := strings.Split(string(output), ";")
-	if len(parts) < 1 {
-		return errors.New("unexpected output from 'gocryptfs -version': " + string(output))
+func (j *Journal) RelatedTags(tag string) ([]TagInfo, error) {
+	if !j.IsMounted() {
+		return []TagInfo{}, errors.New("journal is not mounted")
 	}
+	return j.index.RelatedTags(tag), nil
+}
 
-	versionStr, found := strings.CutPrefix(parts[0], "gocryptfs v")
-	if !found {
-		return errors.New("invalid gocryptfs version: " + parts[0])
+func (j *Journal) RenameTag(from, to string) ([]time.Time, error) {
+	changed := []time.Time{}
+	if j.readOnly {
+		return changed, fmt.Errorf("cannot rename tag, %w", ErrReadOnly)
+	}
+	if tagPattern.FindString(to) != to {
+		return changed, fmt.Errorf("%q is not a valid tag", to)
 	}
 
-	actualVersion, err := version.NewVersion(versionStr)
+	dates, err := j.SearchTag(from)
 	if err != nil {
-		return err
+		return changed, err
 	}
 
-	constraint, _ := version.NewConstraint(">= " + minVersion)
-	if !constraint.Check(actualVersion) {
-		return errors.New("gocryptfs version " + minVersion + " is required, found v" + versionStr)
+	for _, date := range dates {
+		path := j.EntryPath(date)
+		content, err := j.store.Read(path)
+		if err != nil {
+			return changed, err
+		}
+
+		renamed := tagPattern.ReplaceAllStringFunc(string(content), func(tag string) string {
+			if tag == from {
+				return to
+			}
+			if nested, isNested := strings.CutPrefix(tag, from+"/"); isNested {
+				return to + "/" + nested
+			}
+			return tag
+		})
+		if renamed == string(content) {
+			continue
+		}
+
+		err = j.store.Write(path, []byte(renamed))
+		if err != nil {
+			return changed, err
+		}
+		log.Printf("renamed %s to %s in %s", from, to, path)
+		changed = append(changed, date)
 	}
 
-	return nil
+	return changed, nil
+}
+
+func (j *Journal) SearchTag(tag string) ([]time.Time, error) {
+	if !j.IsMounted() {
+		return []time.Time{}, errors.New("journal is not mounted")
+	}
+	return j.index.TagDates(tag), nil
 }
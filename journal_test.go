@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Creates a journal in a temporary plain directory that contains some files,
+// and mounts it.
+func newTestJournal(t *testing.T, files map[string]string, readOnly bool) *Journal {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range files {
+		fullPath := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	journal := NewJournal(NewDirStore(dir), readOnly)
+	if err := journal.Mount(""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { journal.Unmount() })
+	return journal
+}
+
+func day(year, month, day int) time.Time {
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local)
+}
+
+func TestJournalEntryPath(t *testing.T) {
+	journal := NewJournal(NewDirStore(t.TempDir()), false)
+
+	path := journal.EntryPath(day(2025, 3, 7))
+	if path != "2025/03/07.md" {
+		t.Errorf("EntryPath() = %q, want %q", path, "2025/03/07.md")
+	}
+
+	date, err := journal.GetEntryAtPath(path)
+	if err != nil || !date.Equal(day(2025, 3, 7)) {
+		t.Errorf("GetEntryAtPath(%q) = %v, %v", path, date, err)
+	}
+
+	for _, path := range []string{"2025/03/07.txt", "notes.md", "2025/03.md", ".templates/default.md"} {
+		if _, err := journal.GetEntryAtPath(path); err == nil {
+			t.Errorf("GetEntryAtPath(%q) did not fail", path)
+		}
+	}
+}
+
+func TestJournalEntries(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{
+		"2025/02/01.md":         "# Feb",
+		"2024/12/31.md":         "# Dec",
+		"2025/01/15.md":         "# Jan",
+		"2025/01/notes.txt":     "not an entry",
+		".templates/default.md": "# {{.Title}}",
+	}, false)
+
+	entries, err := journal.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Time{day(2024, 12, 31), day(2025, 1, 15), day(2025, 2, 1)}
+	if !slices.EqualFunc(entries, want, time.Time.Equal) {
+		t.Errorf("Entries() = %v, want %v", entries, want)
+	}
+}
+
+func TestJournalGetEntry(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{"2025/01/15.md": "# Jan\n"}, false)
+
+	content, has, err := journal.GetEntry(day(2025, 1, 15))
+	if err != nil || !has || content != "# Jan\n" {
+		t.Errorf("GetEntry() = %q, %v, %v", content, has, err)
+	}
+
+	_, has, err = journal.GetEntry(day(2025, 1, 16))
+	if err != nil || has {
+		t.Errorf("GetEntry() of a missing entry = %v, %v", has, err)
+	}
+
+	has, err = journal.HasEntry(day(2025, 1, 15))
+	if err != nil || !has {
+		t.Errorf("HasEntry() = %v, %v", has, err)
+	}
+}
+
+func TestJournalCreateWriteDelete(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{}, false)
+	date := day(2025, 1, 6)
+
+	path, err := journal.CreateEntry(date, "")
+	if err != nil || path != "2025/01/06.md" {
+		t.Fatalf("CreateEntry() = %q, %v", path, err)
+	}
+	content, _, _ := journal.GetEntry(date)
+	if content != "# Mon - 06 Jan 2025\n\n" {
+		t.Errorf("new entry = %q", content)
+	}
+
+	if err := journal.WriteEntry(date, "changed"); err != nil {
+		t.Fatal(err)
+	}
+	content, _, _ = journal.GetEntry(date)
+	if content != "changed" {
+		t.Errorf("written entry = %q", content)
+	}
+
+	if err := journal.DeleteEntry(date); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := journal.HasEntry(date); has {
+		t.Error("entry still exists after DeleteEntry()")
+	}
+}
+
+func TestJournalReadOnly(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{"2025/01/15.md": "# Jan\n"}, true)
+	date := day(2025, 1, 15)
+
+	if _, err := journal.CreateEntry(day(2025, 1, 16), ""); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("CreateEntry() error = %v, want %v", err, ErrReadOnly)
+	}
+	if err := journal.WriteEntry(date, "changed"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("WriteEntry() error = %v, want %v", err, ErrReadOnly)
+	}
+	if err := journal.DeleteEntry(date); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("DeleteEntry() error = %v, want %v", err, ErrReadOnly)
+	}
+	if _, err := journal.RenameTag("@a", "@b"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("RenameTag() error = %v, want %v", err, ErrReadOnly)
+	}
+
+	content, _, _ := journal.GetEntry(date)
+	if content != "# Jan\n" {
+		t.Errorf("entry changed to %q", content)
+	}
+}
+
+func TestJournalRenameTag(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		from, to string
+		want     map[string]string
+		changed  []time.Time
+	}{
+		{
+			name:    "plain tag",
+			files:   map[string]string{"2025/01/01.md": "@gym in the morning, @gym again", "2025/01/02.md": "@run"},
+			from:    "@gym",
+			to:      "@workout",
+			want:    map[string]string{"2025/01/01.md": "@workout in the morning, @workout again", "2025/01/02.md": "@run"},
+			changed: []time.Time{day(2025, 1, 1)},
+		},
+		{
+			name:    "parent with nested tags",
+			files:   map[string]string{"2025/01/01.md": "@work/x standup", "2025/01/02.md": "@work and @work/x/y", "2025/01/03.md": "@workshop"},
+			from:    "@work",
+			to:      "@job",
+			want:    map[string]string{"2025/01/01.md": "@job/x standup", "2025/01/02.md": "@job and @job/x/y", "2025/01/03.md": "@workshop"},
+			changed: []time.Time{day(2025, 1, 1), day(2025, 1, 2)},
+		},
+		{
+			name:    "nested tag",
+			files:   map[string]string{"2025/01/01.md": "@work/x and @work/xy and @work"},
+			from:    "@work/x",
+			to:      "@side",
+			want:    map[string]string{"2025/01/01.md": "@side and @work/xy and @work"},
+			changed: []time.Time{day(2025, 1, 1)},
+		},
+		{
+			name:    "merge into an existing tag",
+			files:   map[string]string{"2025/01/01.md": "@run", "2025/01/02.md": "@jog", "2025/01/03.md": "@run @jog"},
+			from:    "@jog",
+			to:      "@run",
+			want:    map[string]string{"2025/01/01.md": "@run", "2025/01/02.md": "@run", "2025/01/03.md": "@run @run"},
+			changed: []time.Time{day(2025, 1, 2), day(2025, 1, 3)},
+		},
+		{
+			name:    "tags that start with the same name",
+			files:   map[string]string{"2025/01/01.md": "@a @ab @a_b @a2", "2025/01/02.md": "@ab"},
+			from:    "@a",
+			to:      "@c",
+			want:    map[string]string{"2025/01/01.md": "@c @ab @a_b @a2", "2025/01/02.md": "@ab"},
+			changed: []time.Time{day(2025, 1, 1)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			journal := newTestJournal(t, test.files, false)
+			changed, err := journal.RenameTag(test.from, test.to)
+			if err != nil || !slices.EqualFunc(changed, test.changed, time.Time.Equal) {
+				t.Errorf("RenameTag() = %v, %v, want %v", changed, err, test.changed)
+			}
+			for path, want := range test.want {
+				content, _ := journal.store.Read(path)
+				if string(content) != want {
+					t.Errorf("%s = %q, want %q", path, content, want)
+				}
+			}
+		})
+	}
+
+	journal := newTestJournal(t, map[string]string{"2025/01/01.md": "@a"}, false)
+	for _, to := range []string{"a", "@", "@a b", "@a/"} {
+		if _, err := journal.RenameTag("@a", to); err == nil {
+			t.Errorf("RenameTag() to %q did not fail", to)
+		}
+	}
+}
+
+func TestJournalIndex(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{
+		"2025/01/01.md": "@work standup\n@gym",
+		"2025/01/02.md": "@work/projectx review",
+		"2025/01/03.md": "day off",
+	}, false)
+
+	tags, err := journal.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	if want := []string{"@gym", "@work", "@work/projectx"}; !slices.Equal(names, want) {
+		t.Errorf("Tags() = %v, want %v", names, want)
+	}
+
+	dates, _ := journal.SearchTag("@work")
+	if want := []time.Time{day(2025, 1, 1), day(2025, 1, 2)}; !slices.EqualFunc(dates, want, time.Time.Equal) {
+		t.Errorf("SearchTag(@work) = %v, want %v", dates, want)
+	}
+}
+
+func TestJournalRemount(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{"2025/01/01.md": "@work"}, false)
+
+	if err := journal.Unmount(); err != nil {
+		t.Fatal(err)
+	}
+	if journal.IsMounted() {
+		t.Fatal("journal is still mounted")
+	}
+	if tags := journal.index.Tags(); len(tags) > 0 {
+		t.Errorf("index was not cleared: %v", tags)
+	}
+
+	if err := journal.Mount(""); err != nil {
+		t.Fatal(err)
+	}
+	if dates, _ := journal.SearchTag("@work"); len(dates) != 1 {
+		t.Errorf("SearchTag(@work) after remounting = %v", dates)
+	}
+}
+
+func TestJournalMountUnreadableEntry(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "2025", "01"), 0700)
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "2025", "01", "15.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	journal := NewJournal(NewDirStore(dir), false)
+	locked := false
+	journal.onUnmount = func() { locked = true }
+
+	if err := journal.Mount(""); err == nil {
+		t.Fatal("Mount() did not fail")
+	}
+	if journal.IsMounted() {
+		t.Error("journal is still mounted after failing to load it")
+	}
+	if locked {
+		t.Error("a failed mount was reported as locking the journal")
+	}
+}
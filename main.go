@@ -1,13 +1,16 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	c "github.com/mecha/journal/components"
 
 	t "github.com/gdamore/tcell/v2"
-	"gopkg.in/fsnotify.v1"
 )
 
 const Version = "0.1.0"
@@ -16,10 +19,34 @@ const MinGCFSVersion = "2.6.1"
 func main() {
 	parseFlags()
 
-	if err := checkGCFSVersion(MinGCFSVersion); err != nil {
+	store, err := createStore()
+	if err != nil {
 		log.Fatal(err)
 	}
 
+	switch Flags.command {
+	case CommandInit:
+		if err := runInit(store); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case CommandQuery:
+		if err := runQuery(store); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	journal := NewJournal(store, Flags.readOnly)
+	journal.stageEdits = Config.stageEdits
+
+	// stores that do not need a password can be opened right away
+	if Flags.store == StorePlain {
+		if err := journal.Mount(""); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	screen, err := t.NewScreen()
 	if err != nil {
 		log.Fatal(err)
@@ -28,12 +55,18 @@ func main() {
 		log.Fatal(err)
 	}
 
-	journal, err := NewJournal(Flags.path, Flags.mntPath, Flags.idleTimeout)
+	journal.editor, err = NewEditor(Config.editorLauncher, Config.editorMode, Config.editorAltMode, screen)
 	if err != nil {
+		screen.Fini()
 		log.Fatal(err)
 	}
 
-	app := CreateApp(journal)
+	app := CreateApp(journal, Flags.autoLock)
+	if journal.IsMounted() {
+		app.touch()
+		app.tagsList.update(journal)
+		app.showEntryPreview(app.date)
+	}
 
 	triggerRender := func() {
 		// any event will trigger a render, so we just use a time event
@@ -42,15 +75,63 @@ func main() {
 		screen.PostEvent(ev)
 	}
 
-	journal.onFSEvent = func(ev fsnotify.Event) {
-		app.showEntryPreview(app.date)
-		app.tagsList.update(journal)
-		triggerRender()
+	// these are called from other goroutines, so the app is only updated once
+	// the main loop gets the events
+	journal.onConflict = func(conflict Conflict) {
+		event := &EventConflict{conflict: conflict}
+		event.SetEventNow()
+		screen.PostEvent(event)
 	}
 
-	journal.onUnmount = triggerRender
+	journal.onFSEvent = func(ev StoreEvent) {
+		event := &EventStoreChanged{}
+		event.SetEventNow()
+		screen.PostEvent(event)
+	}
+
+	journal.onUnmount = func() {
+		event := &EventLocked{}
+		event.SetEventNow()
+		screen.PostEvent(event)
+	}
 
 	log.SetOutput(&AppLogWriter{app})
+	cleanStagingDirs()
+
+	if store, isGocryptfs := store.(*GocryptfsStore); isGocryptfs {
+		app.mountIssue = store.CheckMountPoint()
+	}
+
+	app.pwdSources = passwordSources()
+	if app.mountIssue == nil {
+		app.unlockWithSources()
+	}
+
+	// keep re-rendering while idle, for the lock countdown and the inactivity
+	// lock, but only while there is something to lock
+	stopTicker := (chan struct{})(nil)
+	updateTicker := func() {
+		shouldTick := Flags.autoLock > 0 && journal.IsMounted()
+		if shouldTick && stopTicker == nil {
+			stopTicker = make(chan struct{})
+			go func(stop chan struct{}) {
+				ticker := time.NewTicker(time.Second)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						triggerRender()
+					case <-stop:
+						return
+					}
+				}
+			}(stopTicker)
+		} else if !shouldTick && stopTicker != nil {
+			close(stopTicker)
+			stopTicker = nil
+		}
+	}
+	updateTicker()
 
 	defer func() {
 		err := recover()
@@ -67,21 +148,71 @@ func main() {
 	for {
 		ev := screen.PollEvent()
 
+		switch ev := ev.(type) {
+		case *EventStoreChanged:
+			app.showEntryPreview(app.date)
+			app.tagsList.update(journal)
+		case *EventLocked:
+			app.handleLock()
+		case *EventConflict:
+			log.Printf("warning: %s was changed in another editor, and saving it undid those changes", journal.EntryPath(ev.conflict.Date))
+			app.conflicts = append(app.conflicts, &ConflictState{conflict: ev.conflict})
+		}
+
 		if handler == nil || !handler(ev) {
 			switch ev := ev.(type) {
 			case *t.EventResize:
 				screen.Sync()
 			case *t.EventKey:
-				if ev.Key() == t.KeyCtrlC || ev.Rune() == 'q' {
+				if (ev.Key() == t.KeyCtrlC || ev.Rune() == 'q') && app.canQuit() {
 					journal.Unmount()
 					return
 				}
 			}
 		}
 
+		// touched after the handler, since it may block while an editor is open
+		switch ev.(type) {
+		case *t.EventKey, *t.EventMouse, *t.EventPaste:
+			app.touch()
+		}
+
+		app.checkInactivity()
+		updateTicker()
+
 		screen.Clear()
 		screen.HideCursor()
 		handler = DrawApp(renderer, app)
 		screen.Show()
 	}
 }
+
+type EventStoreChanged struct{ t.EventTime }
+
+// Also posted when gocryptfs unmounts the journal on its own.
+type EventLocked struct{ t.EventTime }
+
+type EventConflict struct {
+	t.EventTime
+	conflict Conflict
+}
+
+func createStore() (Store, error) {
+	switch Flags.store {
+	case StoreGocryptfs:
+		if err := checkGCFSVersion(MinGCFSVersion); err != nil {
+			return nil, err
+		}
+		extraArgs := slices.Concat(Config.gocryptfsArgs, Flags.gcfsArgs)
+		if err := validateGocryptfsArgs(extraArgs); err != nil {
+			return nil, err
+		}
+		return NewGocryptfsStore(Flags.path, Flags.mntPath, Flags.idleTimeout, Flags.readOnly, extraArgs), nil
+	case StorePlain:
+		return NewDirStore(Flags.path), nil
+	case StoreVault:
+		return NewVaultStore(Flags.path), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q, must be one of: %s", Flags.store, strings.Join(Stores, ", "))
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+type MountIssue struct {
+	Message string
+	Fix     func() error
+}
+
+type mountInfo struct {
+	mountPoint string
+	fsType     string
+	source     string
+}
+
+func readMounts() ([]mountInfo, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// each line looks like this, with optional fields before the "-":
+	// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+	mounts := []mountInfo{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+
+		mounts = append(mounts, mountInfo{
+			mountPoint: unescapeMountPath(fields[4]),
+			fsType:     fields[sep+1],
+			source:     unescapeMountPath(fields[sep+2]),
+		})
+	}
+
+	return mounts, scanner.Err()
+}
+
+func findMount(path string) (*mountInfo, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts, err := readMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	// later mounts hide earlier ones, so the last match wins
+	var found *mountInfo
+	for _, mount := range mounts {
+		if mount.mountPoint == path {
+			found = &mount
+		}
+	}
+	return found, nil
+}
+
+// mountinfo escapes spaces and other characters as octal codes, like "\040".
+func unescapeMountPath(path string) string {
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if code, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(path[i])
+	}
+	return sb.String()
+}
+
+func fuseUnmount(path string) error {
+	output, err := exec.Command("fusermount", "-u", path).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	output, err = exec.Command("fusermount", "-uz", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("fusermount failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (s *GocryptfsStore) CheckMountPoint() *MountIssue {
+	// a new mount point is created for every mount, so we can only look for
+	// other mounts of the same journal
+	if s.isAutoMount {
+		cipherPath, err := filepath.Abs(s.cipherPath)
+		mounts, _ := readMounts()
+		for _, mount := range mounts {
+			if err == nil && strings.HasPrefix(mount.fsType, "fuse") && mount.source == cipherPath {
+				return mountedIssue(mount)
+			}
+		}
+		return nil
+	}
+
+	mount, err := findMount(s.root)
+	if err != nil {
+		return nil
+	}
+	if mount != nil && strings.HasPrefix(mount.fsType, "fuse") {
+		return mountedIssue(*mount)
+	}
+
+	entries, err := os.ReadDir(s.root)
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+
+	return &MountIssue{
+		Message: fmt.Sprintf("The mount point %s is not empty. Do you want to use a new directory instead?", s.root),
+		Fix: func() error {
+			s.isAutoMount = true
+			log.Println("using a new mount point")
+			return nil
+		},
+	}
+}
+
+// A live gocryptfs belongs to another instance of the app that still uses it.
+func mountedIssue(mount mountInfo) *MountIssue {
+	path := mount.mountPoint
+	message := fmt.Sprintf("A journal was left mounted at %s. Do you want to unmount it?", path)
+	if pid := findGocryptfsProcess(mount); pid > 0 {
+		message = fmt.Sprintf("A journal is mounted at %s by gocryptfs (pid %d), probably for another instance of the app. Quit that instance first. Do you want to unmount it now?", path, pid)
+	} else if _, err := os.Stat(path); errors.Is(err, syscall.ENOTCONN) {
+		message = fmt.Sprintf("A journal was left mounted at %s, but its gocryptfs process is gone. Do you want to unmount it?", path)
+	}
+
+	return &MountIssue{
+		Message: message,
+		Fix: func() error {
+			if pid := findGocryptfsProcess(mount); pid > 0 {
+				return fmt.Errorf("not unmounting %s, since gocryptfs (pid %d) is still running", path, pid)
+			}
+			err := fuseUnmount(path)
+			if err == nil {
+				log.Printf("unmounted journal at %s", path)
+			}
+			return err
+		},
+	}
+}
+
+func findGocryptfsProcess(mount mountInfo) int {
+	procDirs, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0
+	}
+
+	for _, procDir := range procDirs {
+		pid, err := strconv.Atoi(procDir.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join("/proc", procDir.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		args := strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00")
+		if len(args) < 3 || filepath.Base(args[0]) != "gocryptfs" {
+			continue
+		}
+
+		// the paths are relative to the directory that gocryptfs was run in
+		cwd, _ := os.Readlink(filepath.Join("/proc", procDir.Name(), "cwd"))
+		abs := func(path string) string {
+			if filepath.IsAbs(path) {
+				return filepath.Clean(path)
+			}
+			return filepath.Join(cwd, path)
+		}
+		if abs(args[len(args)-1]) == mount.mountPoint || abs(args[len(args)-2]) == mount.source {
+			return pid
+		}
+	}
+	return 0
+}
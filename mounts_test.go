@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindGocryptfsProcess(t *testing.T) {
+	dir := t.TempDir()
+	cipherPath := filepath.Join(dir, "cipher")
+	mountPoint := filepath.Join(dir, "mnt")
+
+	// a shell that is named like gocryptfs, with the same paths at the end of
+	// its arguments, relative to where it runs
+	shell, err := os.ReadFile("/bin/sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	fake := filepath.Join(dir, "gocryptfs")
+	os.WriteFile(fake, shell, 0700)
+
+	mount := mountInfo{mountPoint: mountPoint, fsType: "fuse.gocryptfs", source: cipherPath}
+	if pid := findGocryptfsProcess(mount); pid != 0 {
+		t.Fatalf("found gocryptfs process %d before starting one", pid)
+	}
+
+	cmd := exec.Command(fake, "-c", "sleep 30; :", "cipher", "mnt")
+	cmd.Dir = dir
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	if pid := findGocryptfsProcess(mount); pid != cmd.Process.Pid {
+		t.Errorf("findGocryptfsProcess() = %d, want %d", pid, cmd.Process.Pid)
+	}
+	other := mountInfo{mountPoint: filepath.Join(dir, "other"), source: filepath.Join(dir, "other-cipher")}
+	if pid := findGocryptfsProcess(other); pid != 0 {
+		t.Errorf("findGocryptfsProcess() for another journal = %d", pid)
+	}
+
+	if err := mountedIssue(mount).Fix(); err == nil {
+		t.Error("a journal was unmounted while its gocryptfs process is running")
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	c "github.com/mecha/journal/components"
+	"github.com/mecha/journal/theme"
+	"github.com/mecha/journal/utils"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+type PasswordDialogProps struct {
+	state *PasswordDialogState
+	// the current password is empty when resetting it with the master key
+	onSubmit func(current, new string) error
+}
+
+type PasswordDialogState struct {
+	isOpen        bool
+	masterKey     string
+	currentInput  *c.InputState
+	newInput      *c.InputState
+	confirmInput  *c.InputState
+	focus         int
+	showConfirm   bool
+	confirmChoice bool
+	err           error
+}
+
+func NewPasswordDialogState() *PasswordDialogState {
+	return &PasswordDialogState{
+		currentInput: &c.InputState{},
+		newInput:     &c.InputState{},
+		confirmInput: &c.InputState{},
+	}
+}
+
+func (state *PasswordDialogState) open() {
+	*state = *NewPasswordDialogState()
+	state.isOpen = true
+}
+
+func (state *PasswordDialogState) openReset(masterKey string) {
+	state.open()
+	state.masterKey = masterKey
+}
+
+func (state *PasswordDialogState) close() {
+	*state = *NewPasswordDialogState()
+}
+
+func PasswordDialog(r c.Renderer, props PasswordDialogProps) c.EventHandler {
+	state := props.state
+
+	type field struct {
+		title string
+		input *c.InputState
+	}
+	fields := []field{}
+	if len(state.masterKey) == 0 {
+		fields = append(fields, field{"Current password", state.currentInput})
+	}
+	fields = append(fields,
+		field{"New password", state.newInput},
+		field{"Confirm new password", state.confirmInput},
+	)
+
+	width, _ := r.Size()
+	dialogWidth := min(width, 44)
+
+	errLines := []string{}
+	if state.err != nil {
+		errLines = utils.WrapString(state.err.Error(), dialogWidth-2)
+	}
+
+	hint := []string{}
+	if len(state.masterKey) > 0 {
+		hint = utils.WrapString("Set a new password for the journal, or press <ESC> to keep the current one.", dialogWidth-2)
+	}
+
+	top := len(hint)
+	region := c.CenteredRegion(r, dialogWidth, top+len(fields)*3+len(errLines))
+	region.Fill(' ', theme.Dialog())
+
+	for i, line := range hint {
+		region.PutStrStyled(1, i, line, theme.Dialog())
+	}
+
+	handlers := []c.EventHandler{}
+	for i, field := range fields {
+		hasFocus := i == state.focus && !state.showConfirm
+		handler := c.Box(region.SubRegion(c.NewRect(0, top+i*3, dialogWidth, 3)), c.BoxProps{
+			Title:   field.title,
+			Borders: c.BordersRound,
+			Style:   theme.Borders(hasFocus, theme.Dialog()),
+			Children: func(r c.Renderer) c.EventHandler {
+				return c.Input(r, c.InputProps{
+					State:      field.input,
+					Mask:       "*",
+					HideCursor: !hasFocus,
+				})
+			},
+		})
+		handlers = append(handlers, handler)
+	}
+
+	for i, line := range errLines {
+		region.PutStrStyled(1, top+len(fields)*3+i, line, theme.Dialog().Foreground(t.ColorOrangeRed).Bold(true))
+	}
+
+	if state.showConfirm {
+		return c.Confirm(c.CenteredRegion(r.GetScreen(), 40, 3), true, c.ConfirmProps{
+			Message: "Are you sure you want to change the journal's password?",
+			Yes:     "Yes",
+			No:      "No",
+			Borders: c.BordersRound,
+			Style:   theme.Borders(true, theme.Dialog()),
+			Value:   state.confirmChoice,
+			OnSelect: func(value bool) {
+				state.confirmChoice = value
+			},
+			OnChoice: func(accepted bool) {
+				state.showConfirm = false
+				if !accepted {
+					return
+				}
+				state.err = props.onSubmit(state.currentInput.Value, state.newInput.Value)
+				if state.err == nil {
+					state.close()
+				} else {
+					state.focus = 0
+				}
+			},
+		})
+	}
+
+	return func(ev t.Event) bool {
+		switch ev := ev.(type) {
+		case *t.EventKey:
+			switch ev.Key() {
+			case t.KeyEsc:
+				state.close()
+				return true
+			case t.KeyTab, t.KeyDown:
+				state.focus = (state.focus + 1) % len(fields)
+				return true
+			case t.KeyBacktab, t.KeyUp:
+				state.focus = (state.focus + len(fields) - 1) % len(fields)
+				return true
+			case t.KeyEnter:
+				if state.focus < len(fields)-1 {
+					state.focus++
+					return true
+				}
+				switch {
+				case len(state.newInput.Value) == 0:
+					state.err = ErrEmptyPassword
+				case state.newInput.Value != state.confirmInput.Value:
+					state.err = ErrPasswordMismatch
+				default:
+					state.err = nil
+					state.showConfirm = true
+					state.confirmChoice = false
+				}
+				return true
+			}
+		}
+
+		return handlers[state.focus](ev)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type PasswordSource interface {
+	Name() string
+	Password() (string, error)
+}
+
+type KeyringProvider interface {
+	Lookup(service, account string) (string, error)
+}
+
+const keyringService = "journal"
+
+func passwordSources() []PasswordSource {
+	sources := []PasswordSource{}
+	if len(Flags.passFile) > 0 {
+		sources = append(sources, &PassFileSource{Flags.passFile})
+	}
+	if len(Flags.extPass) > 0 {
+		sources = append(sources, &ExtPassSource{Flags.extPass})
+	}
+	if Flags.keyring {
+		account, err := filepath.Abs(Flags.path)
+		if err != nil {
+			account = Flags.path
+		}
+		sources = append(sources, &KeyringSource{SecretServiceProvider{}, keyringService, account})
+	}
+	return sources
+}
+
+func tryPasswordSources(sources []PasswordSource, unlock func(password string) error) error {
+	errs := []error{}
+	for _, source := range sources {
+		password, err := source.Password()
+		if err == nil {
+			err = unlock(password)
+			if err == nil {
+				return nil
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+	}
+	return errors.Join(errs...)
+}
+
+type PassFileSource struct {
+	path string
+}
+
+func (s *PassFileSource) Name() string {
+	return "password file " + s.path
+}
+
+func (s *PassFileSource) Password() (string, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", err
+	}
+	return firstLine(content)
+}
+
+type ExtPassSource struct {
+	command string
+}
+
+func (s *ExtPassSource) Name() string {
+	return "command `" + s.command + "`"
+}
+
+func (s *ExtPassSource) Password() (string, error) {
+	cmd := exec.Command("sh", "-c", s.command)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return firstLine(output)
+}
+
+type KeyringSource struct {
+	provider KeyringProvider
+	service  string
+	account  string
+}
+
+func (s *KeyringSource) Name() string {
+	return "keyring"
+}
+
+func (s *KeyringSource) Password() (string, error) {
+	return s.provider.Lookup(s.service, s.account)
+}
+
+func firstLine(output []byte) (string, error) {
+	line, _, _ := bytes.Cut(output, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(line) == 0 {
+		return "", ErrEmptyPassword
+	}
+	return string(line), nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// A keyring that keeps its secrets in memory, keyed by "service/account".
+type fakeKeyring map[string]string
+
+func (k fakeKeyring) Lookup(service, account string) (string, error) {
+	secret, found := k[service+"/"+account]
+	if !found {
+		return "", errors.New("no password stored for " + account)
+	}
+	return secret, nil
+}
+
+// A password source that records when it is used.
+type recordingSource struct {
+	PasswordSource
+	used *[]string
+}
+
+func (s recordingSource) Password() (string, error) {
+	*s.used = append(*s.used, s.Name())
+	return s.PasswordSource.Password()
+}
+
+func TestTryPasswordSources(t *testing.T) {
+	passFile := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(passFile, []byte("from file\nsecond line\n"), 0600)
+	keyring := fakeKeyring{"journal/work": "from keyring"}
+
+	tests := []struct {
+		name     string
+		sources  []PasswordSource
+		password string
+		wantUsed []string
+		wantErr  bool
+	}{
+		{
+			name: "first source works",
+			sources: []PasswordSource{
+				&PassFileSource{passFile},
+				&KeyringSource{keyring, "journal", "work"},
+			},
+			password: "from file",
+			wantUsed: []string{"password file " + passFile},
+		},
+		{
+			name: "falls through when there is no password",
+			sources: []PasswordSource{
+				&PassFileSource{passFile + ".missing"},
+				&KeyringSource{keyring, "journal", "home"},
+				&ExtPassSource{"echo from command"},
+			},
+			password: "from command",
+			wantUsed: []string{"password file " + passFile + ".missing", "keyring", "command `echo from command`"},
+		},
+		{
+			name: "falls through when the password is wrong",
+			sources: []PasswordSource{
+				&ExtPassSource{"echo wrong"},
+				&KeyringSource{keyring, "journal", "work"},
+			},
+			password: "from keyring",
+			wantUsed: []string{"command `echo wrong`", "keyring"},
+		},
+		{
+			name: "all sources fail",
+			sources: []PasswordSource{
+				&ExtPassSource{"exit 1"},
+				&PassFileSource{passFile},
+			},
+			password: "something else",
+			wantUsed: []string{"command `exit 1`", "password file " + passFile},
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			used := []string{}
+			sources := []PasswordSource{}
+			for _, source := range test.sources {
+				sources = append(sources, recordingSource{source, &used})
+			}
+
+			unlocked := ""
+			err := tryPasswordSources(sources, func(password string) error {
+				if password != test.password {
+					return ErrIncorrectPassword
+				}
+				unlocked = password
+				return nil
+			})
+
+			if test.wantErr {
+				if err == nil || !errors.Is(err, ErrIncorrectPassword) {
+					t.Errorf("tryPasswordSources() error = %v", err)
+				}
+				if !strings.Contains(err.Error(), "command `exit 1`") {
+					t.Errorf("error does not name the failed source: %v", err)
+				}
+			} else if err != nil || unlocked != test.password {
+				t.Errorf("tryPasswordSources() = %v, unlocked with %q", err, unlocked)
+			}
+			if !slices.Equal(used, test.wantUsed) {
+				t.Errorf("sources were tried in the order %v, want %v", used, test.wantUsed)
+			}
+		})
+	}
+}
+
+func TestPasswordWithoutNewline(t *testing.T) {
+	passFile := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(passFile, []byte("secret"), 0600)
+
+	sources := []PasswordSource{
+		&PassFileSource{passFile},
+		&ExtPassSource{"printf secret"},
+		&ExtPassSource{"printf secret | cat"},
+	}
+	for _, source := range sources {
+		if password, err := source.Password(); err != nil || password != "secret" {
+			t.Errorf("%s: Password() = %q, %v", source.Name(), password, err)
+		}
+	}
+}
+
+func TestFirstLine(t *testing.T) {
+	tests := map[string]string{
+		"secret":          "secret",
+		"secret\n":        "secret",
+		"secret\r\nmore":  "secret",
+		"with spaces  \n": "with spaces  ",
+	}
+	for output, want := range tests {
+		if line, err := firstLine([]byte(output)); err != nil || line != want {
+			t.Errorf("firstLine(%q) = %q, %v, want %q", output, line, err, want)
+		}
+	}
+
+	if _, err := firstLine([]byte("\nsecret")); !errors.Is(err, ErrEmptyPassword) {
+		t.Errorf("firstLine() of an empty line error = %v, want %v", err, ErrEmptyPassword)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidQuery = errors.New("Invalid query")
+
+// Parsed from expressions like: @work -@travel after:2025-01-01 "standup"
+type Query interface {
+	eval(j *Journal, entries dateSet) (dateSet, error)
+	// the text to highlight in the matching entries
+	terms() []string
+}
+
+type dateSet = map[time.Time]bool
+
+type TagQuery struct{ Tag string }
+
+type TextQuery struct{ Text string }
+
+type AfterQuery struct{ Date time.Time }
+
+type BeforeQuery struct{ Date time.Time }
+
+type NotQuery struct{ Query Query }
+
+type AndQuery struct{ Queries []Query }
+
+type OrQuery struct{ Queries []Query }
+
+func (q *TagQuery) eval(j *Journal, entries dateSet) (dateSet, error) {
+	dates, err := j.SearchTag(q.Tag)
+	if err != nil {
+		return nil, err
+	}
+	matches := dateSet{}
+	for _, date := range dates {
+		if entries[date] {
+			matches[date] = true
+		}
+	}
+	return matches, nil
+}
+
+func (q *TextQuery) eval(j *Journal, entries dateSet) (dateSet, error) {
+	matches := dateSet{}
+	for _, result := range j.index.Search(q.Text) {
+		if entries[result.Date] {
+			matches[result.Date] = true
+		}
+	}
+	return matches, nil
+}
+
+func (q *AfterQuery) eval(j *Journal, entries dateSet) (dateSet, error) {
+	return filterDates(entries, func(date time.Time) bool { return !date.Before(q.Date) }), nil
+}
+
+func (q *BeforeQuery) eval(j *Journal, entries dateSet) (dateSet, error) {
+	return filterDates(entries, func(date time.Time) bool { return !date.After(q.Date) }), nil
+}
+
+func (q *NotQuery) eval(j *Journal, entries dateSet) (dateSet, error) {
+	excluded, err := q.Query.eval(j, entries)
+	if err != nil {
+		return nil, err
+	}
+	return filterDates(entries, func(date time.Time) bool { return !excluded[date] }), nil
+}
+
+func (q *AndQuery) eval(j *Journal, entries dateSet) (dateSet, error) {
+	matches := entries
+	for _, query := range q.Queries {
+		var err error
+		matches, err = query.eval(j, matches)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
+func (q *OrQuery) eval(j *Journal, entries dateSet) (dateSet, error) {
+	matches := dateSet{}
+	for _, query := range q.Queries {
+		dates, err := query.eval(j, entries)
+		if err != nil {
+			return nil, err
+		}
+		for date := range dates {
+			matches[date] = true
+		}
+	}
+	return matches, nil
+}
+
+func (q *TagQuery) terms() []string    { return []string{q.Tag} }
+func (q *TextQuery) terms() []string   { return []string{q.Text} }
+func (q *AfterQuery) terms() []string  { return []string{} }
+func (q *BeforeQuery) terms() []string { return []string{} }
+func (q *NotQuery) terms() []string    { return []string{} }
+func (q *AndQuery) terms() []string    { return allTerms(q.Queries) }
+func (q *OrQuery) terms() []string     { return allTerms(q.Queries) }
+
+func allTerms(queries []Query) []string {
+	terms := []string{}
+	for _, query := range queries {
+		terms = append(terms, query.terms()...)
+	}
+	return terms
+}
+
+func filterDates(dates dateSet, keep func(date time.Time) bool) dateSet {
+	filtered := dateSet{}
+	for date := range dates {
+		if keep(date) {
+			filtered[date] = true
+		}
+	}
+	return filtered
+}
+
+const queryDateFormat = "2006-01-02"
+
+type queryTokenKind int
+
+const (
+	tokenWord queryTokenKind = iota
+	tokenPhrase
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+}
+
+func tokenizeQuery(expr string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	runes := []rune(expr)
+	isWordEnd := func(r rune) bool {
+		return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+	}
+
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '(':
+			tokens = append(tokens, queryToken{tokenOpen, "("})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, queryToken{tokenClose, ")"})
+			i++
+
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, queryToken{tokenNot, "-"})
+			i++
+
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("%w: missing closing quote", ErrInvalidQuery)
+			}
+			tokens = append(tokens, queryToken{tokenPhrase, string(runes[i+1 : end])})
+			i = end + 1
+
+		default:
+			end := i
+			for end < len(runes) && !isWordEnd(runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			switch word {
+			case "AND":
+				tokens = append(tokens, queryToken{tokenAnd, word})
+			case "OR":
+				tokens = append(tokens, queryToken{tokenOr, word})
+			case "NOT":
+				tokens = append(tokens, queryToken{tokenNot, word})
+			default:
+				tokens = append(tokens, queryToken{tokenWord, word})
+			}
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+func ParseQuery(expr string) (Query, error) {
+	tokens, err := tokenizeQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := &queryParser{tokens: tokens}
+	query, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, p.tokens[p.pos].text)
+	}
+	return query, nil
+}
+
+// OR binds less tightly than AND, which binds less tightly than negation.
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (Query, error) {
+	queries := []Query{}
+	for {
+		query, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+
+		if token, ok := p.peek(); !ok || token.kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+
+	if len(queries) == 1 {
+		return queries[0], nil
+	}
+	return &OrQuery{queries}, nil
+}
+
+func (p *queryParser) parseAnd() (Query, error) {
+	queries := []Query{}
+	for {
+		token, ok := p.peek()
+		if !ok || token.kind == tokenOr || token.kind == tokenClose {
+			break
+		}
+		if token.kind == tokenAnd {
+			p.pos++
+			next, ok := p.peek()
+			if len(queries) == 0 || !ok || next.kind == tokenOr || next.kind == tokenClose || next.kind == tokenAnd {
+				return nil, fmt.Errorf("%w: AND must be between two terms", ErrInvalidQuery)
+			}
+			continue
+		}
+
+		query, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+
+	switch len(queries) {
+	case 0:
+		if token, ok := p.peek(); ok {
+			return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, token.text)
+		}
+		return nil, fmt.Errorf("%w: unexpected end of query", ErrInvalidQuery)
+	case 1:
+		return queries[0], nil
+	default:
+		return &AndQuery{queries}, nil
+	}
+}
+
+func (p *queryParser) parseUnary() (Query, error) {
+	token, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected end of query", ErrInvalidQuery)
+	}
+	p.pos++
+
+	switch token.kind {
+	case tokenNot:
+		query, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotQuery{query}, nil
+
+	case tokenOpen:
+		query, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token, ok := p.peek(); !ok || token.kind != tokenClose {
+			return nil, fmt.Errorf("%w: missing closing parenthesis", ErrInvalidQuery)
+		}
+		p.pos++
+		return query, nil
+
+	case tokenPhrase:
+		return &TextQuery{token.text}, nil
+
+	case tokenWord:
+		return parseQueryWord(token.text)
+	}
+
+	return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, token.text)
+}
+
+func parseQueryWord(word string) (Query, error) {
+	if strings.HasPrefix(word, "@") {
+		if tagPattern.FindString(word) != word {
+			return nil, fmt.Errorf("%w: %q is not a tag", ErrInvalidQuery, word)
+		}
+		return &TagQuery{word}, nil
+	}
+
+	if key, value, found := strings.Cut(word, ":"); found && (key == "after" || key == "before") {
+		date, err := time.ParseInLocation(queryDateFormat, value, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not a date like 2025-01-31", ErrInvalidQuery, value)
+		}
+		if key == "after" {
+			return &AfterQuery{date}, nil
+		}
+		return &BeforeQuery{date}, nil
+	}
+
+	return &TextQuery{word}, nil
+}
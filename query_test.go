@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTokenizeQuery(t *testing.T) {
+	tokens, err := tokenizeQuery(`(@gym OR -@run) AND NOT "daily  standup" after:2025-01-01`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []queryToken{
+		{tokenOpen, "("},
+		{tokenWord, "@gym"},
+		{tokenOr, "OR"},
+		{tokenNot, "-"},
+		{tokenWord, "@run"},
+		{tokenClose, ")"},
+		{tokenAnd, "AND"},
+		{tokenNot, "NOT"},
+		{tokenPhrase, "daily  standup"},
+		{tokenWord, "after:2025-01-01"},
+	}
+	if !slices.Equal(tokens, want) {
+		t.Errorf("tokenizeQuery() = %v, want %v", tokens, want)
+	}
+
+	// a dash on its own or inside a word is not a negation, and lowercase
+	// operators are words
+	tokens, _ = tokenizeQuery("half-time - or")
+	want = []queryToken{{tokenWord, "half-time"}, {tokenWord, "-"}, {tokenWord, "or"}}
+	if !slices.Equal(tokens, want) {
+		t.Errorf("tokenizeQuery() = %v, want %v", tokens, want)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Query
+	}{
+		{"", nil},
+		{"@work", &TagQuery{"@work"}},
+		{"standup", &TextQuery{"standup"}},
+		{`"daily standup"`, &TextQuery{"daily standup"}},
+		{"after:2025-01-31", &AfterQuery{day(2025, 1, 31)}},
+		{"before:2025-01-31", &BeforeQuery{day(2025, 1, 31)}},
+		{"@work -@travel", &AndQuery{[]Query{&TagQuery{"@work"}, &NotQuery{&TagQuery{"@travel"}}}}},
+		{"@a AND @b", &AndQuery{[]Query{&TagQuery{"@a"}, &TagQuery{"@b"}}}},
+		{
+			// AND binds more tightly than OR
+			"@a @b OR @c",
+			&OrQuery{[]Query{&AndQuery{[]Query{&TagQuery{"@a"}, &TagQuery{"@b"}}}, &TagQuery{"@c"}}},
+		},
+		{
+			"(@gym OR @run) NOT lazy",
+			&AndQuery{[]Query{
+				&OrQuery{[]Query{&TagQuery{"@gym"}, &TagQuery{"@run"}}},
+				&NotQuery{&TextQuery{"lazy"}},
+			}},
+		},
+		{"NOT NOT @a", &NotQuery{&NotQuery{&TagQuery{"@a"}}}},
+	}
+	for _, test := range tests {
+		query, err := ParseQuery(test.expr)
+		if err != nil || !reflect.DeepEqual(query, test.want) {
+			t.Errorf("ParseQuery(%q) = %#v, %v, want %#v", test.expr, query, err, test.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	exprs := []string{
+		`"unclosed`,
+		"(@a",
+		"@a)",
+		"()",
+		"@a OR",
+		"OR @a",
+		"AND @a",
+		"@a AND",
+		"@a AND AND @b",
+		"NOT",
+		"@not-a-tag!",
+		"after:yesterday",
+		"before:2025-13-01",
+	}
+	for _, expr := range exprs {
+		if query, err := ParseQuery(expr); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("ParseQuery(%q) = %#v, %v, want %v", expr, query, err, ErrInvalidQuery)
+		}
+	}
+}
+
+func TestJournalQuery(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{
+		"2025/01/01.md": "@work daily standup",
+		"2025/01/02.md": "@work @travel standup from the airport",
+		"2025/01/03.md": "@gym, feeling lazy",
+		"2025/01/04.md": "@run @work/projectx",
+	}, false)
+
+	tests := []struct {
+		expr string
+		want []time.Time
+	}{
+		{"@work", []time.Time{day(2025, 1, 1), day(2025, 1, 2), day(2025, 1, 4)}},
+		{"@work -@travel", []time.Time{day(2025, 1, 1), day(2025, 1, 4)}},
+		{`"DAILY standup"`, []time.Time{day(2025, 1, 1)}},
+		{"(@gym OR @run) NOT lazy", []time.Time{day(2025, 1, 4)}},
+		{"after:2025-01-02 before:2025-01-03", []time.Time{day(2025, 1, 2), day(2025, 1, 3)}},
+		{"@nothing", []time.Time{}},
+	}
+	for _, test := range tests {
+		query, err := ParseQuery(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dates, err := journal.Query(query)
+		if err != nil || !slices.EqualFunc(dates, test.want, time.Time.Equal) {
+			t.Errorf("Query(%q) = %v, %v, want %v", test.expr, dates, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// The directory is kept in memory, so that decrypted files never reach a drive.
+func runtimeDir() (string, error) {
+	if dir, hasEnv := os.LookupEnv("XDG_RUNTIME_DIR"); hasEnv && len(dir) > 0 {
+		return dir, nil
+	}
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm", nil
+	}
+	return "", errors.New("no in-memory directory for temporary files, please set $XDG_RUNTIME_DIR")
+}
+
+// Named after the app's pid, to find the ones that a killed app left behind.
+const stagingDirPrefix = "journal-edit-"
+
+func cleanStagingDirs() {
+	dir, err := runtimeDir()
+	if err != nil {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, entry := range entries {
+		rest, isStaging := strings.CutPrefix(entry.Name(), stagingDirPrefix)
+		pidStr, _, _ := strings.Cut(rest, "-")
+		pid, err := strconv.Atoi(pidStr)
+		if !isStaging || !entry.IsDir() || err != nil || isRunning(pid) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			log.Println("failed to remove staged entry; ", err)
+		} else {
+			log.Printf("removed an entry that was left in %s", filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+func isRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
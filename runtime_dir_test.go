@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanStagingDirs(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+
+	// no process can have the largest pid, so its directory is stale
+	stale := fmt.Sprintf("%s%d-123", stagingDirPrefix, 1<<31-1)
+	running := fmt.Sprintf("%s%d-456", stagingDirPrefix, os.Getpid())
+	for _, name := range []string{stale, running, "journal-789", stagingDirPrefix + "x-1"} {
+		os.Mkdir(filepath.Join(dir, name), 0700)
+		os.WriteFile(filepath.Join(dir, name, "2025-01-15.md"), []byte("private"), 0600)
+	}
+
+	cleanStagingDirs()
+
+	if _, err := os.Stat(filepath.Join(dir, stale)); !os.IsNotExist(err) {
+		t.Errorf("stale staging dir was not removed: %v", err)
+	}
+	for _, name := range []string{running, "journal-789", stagingDirPrefix + "x-1"} {
+		if _, err := os.Stat(filepath.Join(dir, name, "2025-01-15.md")); err != nil {
+			t.Errorf("%s was removed: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	c "github.com/mecha/journal/components"
+	"github.com/mecha/journal/theme"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+type SearchProps struct {
+	state    *SearchState
+	journal  *Journal
+	hasFocus bool
+	onSelect func(result SearchResult)
+	onEdit   func(date time.Time, altMode bool)
+}
+
+type SearchState struct {
+	input          *c.InputState
+	query          Query
+	results        []SearchResult
+	err            error
+	resultList     *c.ListState[SearchResult]
+	isResultsFocus bool
+}
+
+func NewSearchState() *SearchState {
+	return &SearchState{
+		input:      &c.InputState{},
+		results:    []SearchResult{},
+		resultList: &c.ListState[SearchResult]{},
+	}
+}
+
+func (state *SearchState) search(journal *Journal) {
+	state.results = []SearchResult{}
+	state.resultList.Cursor = 0
+	state.resultList.VScroll = 0
+
+	state.query, state.err = ParseQuery(state.input.Value)
+	if state.err != nil || state.query == nil {
+		return
+	}
+
+	results, err := journal.Search(state.query)
+	if err != nil {
+		log.Println("failed to search journal; ", err)
+	}
+	state.results = results
+}
+
+func (state *SearchState) highlights() []string {
+	if state.query == nil {
+		return []string{}
+	}
+	return state.query.terms()
+}
+
+func SearchPanel(r c.Renderer, props SearchProps) c.EventHandler {
+	state := props.state
+
+	title := "[5]─Search"
+	if state.query != nil {
+		title += fmt.Sprintf(" (%d)", len(state.results))
+	}
+
+	return c.Box(r, c.BoxProps{
+		Title:   panelTitle(props.journal, title),
+		Borders: c.BordersRound,
+		Style:   theme.Borders(props.hasFocus),
+		Children: func(r c.Renderer) c.EventHandler {
+			width, _ := r.Size()
+			inputRegion, listRegion := r.SplitVertical(1)
+
+			inputRegion.PutStrStyled(0, 0, ">", theme.Borders(props.hasFocus && !state.isResultsFocus))
+			inputHandler := c.Input(inputRegion.SubRegion(c.NewRect(2, 0, width-2, 1)), c.InputProps{
+				State:      state.input,
+				HideCursor: !props.hasFocus || state.isResultsFocus,
+			})
+
+			switch {
+			case state.err != nil:
+				listRegion.PutStrStyled(0, 0, state.err.Error(), theme.Help().Foreground(t.ColorOrangeRed))
+			case state.query != nil && len(state.results) == 0:
+				listRegion.PutStrStyled(0, 0, "[No results]", theme.Help())
+			}
+
+			listHandler := c.List(listRegion, c.ListProps[SearchResult]{
+				State:        state.resultList,
+				Items:        state.results,
+				ShowSelected: props.hasFocus && state.isResultsFocus,
+				RenderFunc: func(result SearchResult) string {
+					return result.Date.Format("02 Jan 2006") + "  " + strings.TrimSpace(result.Text)
+				},
+				OnSelect: func(i int, result SearchResult) {
+					props.onSelect(result)
+				},
+				OnEnter: func(i int, result SearchResult) {
+					props.onEdit(result.Date, false)
+				},
+			})
+
+			return func(ev t.Event) bool {
+				key, isKey := ev.(*t.EventKey)
+
+				if !state.isResultsFocus {
+					if isKey {
+						switch key.Key() {
+						case t.KeyEnter:
+							state.search(props.journal)
+							if len(state.results) > 0 {
+								state.isResultsFocus = true
+								props.onSelect(state.results[0])
+							}
+							return true
+						case t.KeyDown:
+							if len(state.results) > 0 {
+								state.isResultsFocus = true
+								props.onSelect(state.results[state.resultList.Cursor])
+							}
+							return true
+						}
+					}
+					return inputHandler(ev)
+				}
+
+				if isKey && (key.Key() == t.KeyEsc || key.Rune() == '/') {
+					state.isResultsFocus = false
+					return true
+				}
+				return listHandler(ev)
+			}
+		},
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const secretServiceName = "org.freedesktop.secrets"
+const secretServicePath = "/org/freedesktop/secrets"
+const secretServiceInterface = "org.freedesktop.Secret.Service"
+
+// The unlock prompt may never be shown, so the password is asked for instead.
+var keyringPromptTimeout = time.Minute
+
+type SecretServiceProvider struct{}
+
+type secretServiceSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+func (SecretServiceProvider) Lookup(service, account string) (string, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	secrets := conn.Object(secretServiceName, secretServicePath)
+
+	// a plain session does not encrypt the secret, which only ever goes over
+	// the user's own session bus
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err = secrets.Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session)
+	if err != nil {
+		return "", fmt.Errorf("failed to open a keyring session: %w", err)
+	}
+	defer conn.Object(secretServiceName, session).Call("org.freedesktop.Secret.Session.Close", 0)
+
+	var unlocked, locked []dbus.ObjectPath
+	attributes := map[string]string{"service": service, "account": account}
+	err = secrets.Call(secretServiceInterface+".SearchItems", 0, attributes).Store(&unlocked, &locked)
+	if err != nil {
+		return "", err
+	}
+	if len(unlocked) == 0 && len(locked) > 0 {
+		unlocked, err = unlockSecretItems(conn, secrets, locked)
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(unlocked) == 0 {
+		return "", errors.New("no password stored for " + account)
+	}
+
+	var result map[dbus.ObjectPath]secretServiceSecret
+	err = secrets.Call(secretServiceInterface+".GetSecrets", 0, unlocked[:1], session).Store(&result)
+	if err != nil {
+		return "", err
+	}
+	secret, found := result[unlocked[0]]
+	if !found || len(secret.Value) == 0 {
+		return "", errors.New("no password stored for " + account)
+	}
+	defer clear(secret.Value)
+
+	return string(secret.Value), nil
+}
+
+func unlockSecretItems(conn *dbus.Conn, secrets dbus.BusObject, items []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := secrets.Call(secretServiceInterface+".Unlock", 0, items).Store(&unlocked, &prompt)
+	if err != nil || prompt == "/" {
+		return unlocked, err
+	}
+
+	err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface("org.freedesktop.Secret.Prompt"),
+		dbus.WithMatchMember("Completed"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	signals := make(chan *dbus.Signal, 1)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	err = conn.Object(secretServiceName, prompt).Call("org.freedesktop.Secret.Prompt.Prompt", 0, "").Err
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.After(keyringPromptTimeout)
+	for {
+		select {
+		case signal, ok := <-signals:
+			if !ok {
+				return nil, errors.New("lost the connection to the keyring")
+			}
+			if signal.Path != prompt || len(signal.Body) < 2 {
+				continue
+			}
+			if dismissed, _ := signal.Body[0].(bool); dismissed {
+				return nil, errors.New("the keyring was not unlocked")
+			}
+			result, _ := signal.Body[1].(dbus.Variant)
+			unlocked, _ = result.Value().([]dbus.ObjectPath)
+			return unlocked, nil
+		case <-timeout:
+			conn.Object(secretServiceName, prompt).Call("org.freedesktop.Secret.Prompt.Dismiss", 0)
+			return nil, fmt.Errorf("the keyring was not unlocked within %s", keyringPromptTimeout)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	c "github.com/mecha/journal/components"
+	"github.com/mecha/journal/theme"
+	"github.com/mecha/journal/utils"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+type SetupState struct {
+	pwdInput       *c.InputState
+	confirmInput   *c.InputState
+	isConfirmFocus bool
+	err            error
+}
+
+func (app *App) handleSetup() {
+	state := app.setup
+	password, confirm := state.pwdInput.Value, state.confirmInput.Value
+	state.pwdInput.Value, state.pwdInput.Cursor = "", 0
+	state.confirmInput.Value, state.confirmInput.Cursor = "", 0
+	state.isConfirmFocus = false
+	state.err = nil
+
+	switch {
+	case len(password) == 0:
+		state.err = ErrEmptyPassword
+		return
+	case password != confirm:
+		state.err = ErrPasswordMismatch
+		return
+	}
+
+	masterKey, err := app.journal.Init(password)
+	if err != nil {
+		log.Println("failed to create journal; ", err)
+		state.err = err
+		return
+	}
+	log.Println("Created new journal")
+
+	app.pwdError = app.unlock(password)
+	app.masterKey = masterKey
+}
+
+func DrawSetup(r c.Renderer, app *App) c.EventHandler {
+	state := app.setup
+	width, _ := r.Size()
+
+	rect := c.CenterRect(r.GetRegion(), min(width, 40), 6)
+	pwdRect, confirmRect := rect.SplitVertical(3)
+
+	inputBox := func(rect c.Rect, title string, input *c.InputState, hasFocus bool) c.EventHandler {
+		style := theme.Borders(hasFocus)
+		if state.err != nil {
+			style = style.Foreground(t.ColorOrangeRed)
+		}
+		return c.Box(r.SubRegion(rect), c.BoxProps{
+			Title:   title,
+			Borders: c.BordersRound,
+			Style:   style,
+			Children: func(r c.Renderer) c.EventHandler {
+				return c.Input(r, c.InputProps{
+					State:      input,
+					Mask:       "*",
+					HideCursor: !hasFocus,
+				})
+			},
+		})
+	}
+
+	pwdHandler := inputBox(pwdRect, "New journal password", state.pwdInput, !state.isConfirmFocus)
+	confirmHandler := inputBox(confirmRect, "Confirm password", state.confirmInput, state.isConfirmFocus)
+
+	logoRegion := r.SubRegion(c.Rect{
+		Pos:  c.Pos{X: (width - LogoSize.W) / 2, Y: rect.Y - LogoSize.H},
+		Size: LogoSize,
+	})
+	for i, line := range Logo {
+		logoRegion.PutStrStyled(0, i, line, theme.Logo())
+	}
+
+	if state.err != nil {
+		errRect := c.NewRect(rect.X+1, rect.Y+rect.H, rect.W-2, 3)
+		c.Text(r.SubRegion(errRect), c.TextProps{
+			Style: theme.BordersFocus().Foreground(t.ColorOrangeRed).Bold(true),
+			State: &c.TextState{Lines: []string{state.err.Error()}},
+		})
+	}
+
+	return func(ev t.Event) bool {
+		switch ev := ev.(type) {
+		case *t.EventKey:
+			switch ev.Key() {
+			case t.KeyTab, t.KeyBacktab, t.KeyUp, t.KeyDown:
+				state.isConfirmFocus = !state.isConfirmFocus
+				return true
+			case t.KeyEnter:
+				if state.isConfirmFocus {
+					app.handleSetup()
+				} else {
+					state.isConfirmFocus = true
+				}
+				return true
+			}
+		}
+
+		if state.isConfirmFocus {
+			return confirmHandler(ev)
+		} else {
+			return pwdHandler(ev)
+		}
+	}
+}
+
+func DrawMasterKey(r c.Renderer, app *App) c.EventHandler {
+	width, _ := r.Size()
+
+	// show the key as two lines of 4 groups, since it's quite long
+	groups := strings.Split(app.masterKey, "-")
+	half := (len(groups) + 1) / 2
+	keyLines := []string{
+		strings.Join(groups[:half], "-"),
+		strings.Join(groups[half:], "-"),
+	}
+
+	boxWidth := min(width, 60)
+	message := []string{"Your new journal's master key is:", ""}
+	message = append(message, keyLines...)
+	message = append(message, "")
+	message = append(message, utils.WrapString(
+		"Write it down and keep it somewhere safe. It is the only way to recover the journal if you forget the password.",
+		boxWidth-4,
+	)...)
+
+	rect := c.CenterRect(r.GetRegion(), boxWidth, len(message)+4)
+	region := r.SubRegion(rect)
+	region.Fill(' ', theme.Dialog())
+
+	return c.Box(region, c.BoxProps{
+		Title:   "Master key",
+		Borders: c.BordersRound,
+		Style:   theme.BordersFocus(),
+		Children: func(r c.Renderer) c.EventHandler {
+			w, h := r.Size()
+			for i, line := range message {
+				x := 1
+				if i >= 2 && i < 2+len(keyLines) {
+					x = max(0, (w-len(line))/2)
+				}
+				r.PutStrStyled(x, i, line, theme.Dialog())
+			}
+
+			btnText := "I have written it down"
+			return c.Button(r, c.ButtonProps{
+				Pos:      c.Pos{X: w - len(btnText) - 5, Y: h - 1},
+				Text:     btnText,
+				HasFocus: true,
+				OnEnter: func() {
+					app.masterKey = ""
+				},
+			})
+		},
+	})
+}
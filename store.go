@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"regexp"
+	"strings"
+)
+
+var ErrNotInitialized = errors.New("Journal has not been set up yet")
+var ErrEmptyPassword = errors.New("Password cannot be empty")
+var ErrPasswordMismatch = errors.New("Passwords do not match")
+var ErrInvalidMasterKey = errors.New("Invalid master key")
+
+var masterKeyPattern = regexp.MustCompile(`[0-9a-f]{8}(-[0-9a-f]{8}){7}`)
+
+// Paths are relative to the root of the store and use "/", e.g. "2025/01/31.md".
+type Store interface {
+	Mount(password string) error
+	// Does nothing if the store is not mounted.
+	Unmount() error
+	IsMounted() bool
+	List() ([]string, error)
+	// Returns an error that satisfies os.IsNotExist for missing files.
+	Read(path string) ([]byte, error)
+	// Creates any missing parent directories.
+	Write(path string, data []byte) error
+	Delete(path string) error
+	// Returns an error that satisfies os.IsNotExist for missing files.
+	Stat(path string) (fs.FileInfo, error)
+	Watch(onChange func(ev StoreEvent))
+	OnUnmount(fn func())
+}
+
+type StoreEvent struct {
+	Path    string
+	Removed bool
+}
+
+// A store whose files can be opened directly by external programs like editors.
+type LocalStore interface {
+	Store
+	LocalPath(path string) string
+}
+
+type InitStore interface {
+	Store
+	IsInitialized() bool
+	Init(password string) (masterKey string, err error)
+}
+
+type PasswordStore interface {
+	Store
+	ChangePassword(oldPassword, newPassword string) error
+}
+
+type RecoveryStore interface {
+	Store
+	MountMasterKey(masterKey string) error
+	ResetPassword(masterKey, newPassword string) error
+}
+
+func normalizeMasterKey(masterKey string) (string, error) {
+	masterKey = strings.ToLower(strings.Join(strings.Fields(masterKey), ""))
+	if !masterKeyPattern.MatchString(masterKey) || len(masterKey) != 71 {
+		return "", ErrInvalidMasterKey
+	}
+	return masterKey, nil
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"slices"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	c "github.com/mecha/journal/components"
 	"github.com/mecha/journal/theme"
+	"github.com/mecha/journal/utils"
 
 	t "github.com/gdamore/tcell/v2"
 )
@@ -17,27 +21,150 @@ type TagsProps struct {
 	hasFocus      bool
 	onSelectRef   func(time.Time)
 	onDeselectRef func()
+	onEdit        func(date time.Time, altMode bool)
 }
 
 type TagsState struct {
 	isShowRefs bool
-	tags       []string
+	tags       []TagInfo
+	tagTree    []*c.TreeNode[TagInfo]
+	sortMode   TagSort
 	refs       []time.Time
-	tagList    *c.ListState[string]
+	tagList    *c.TreeState[TagInfo]
 	refList    *c.ListState[time.Time]
+	rename     *TagRenameState
+	// the related tag narrows the references down to the entries that use both
+	refsTag        string
+	narrowTag      string
+	related        []TagInfo
+	relatedList    *c.ListState[TagInfo]
+	isRelatedFocus bool
+	filter         *c.InputState
+	isFiltering    bool
 }
 
+type TagRenameState struct {
+	from          string
+	to            string
+	dates         []time.Time
+	input         *c.InputState
+	showPrompt    bool
+	showConfirm   bool
+	confirmChoice bool
+}
+
+type TagSort int
+
+const (
+	SortByName TagSort = iota
+	SortByCount
+	SortByRecency
+	numTagSorts
+)
+
+var tagSortNames = []string{"name", "count", "last used"}
+
 func (state *TagsState) update(journal *Journal) {
-	if journal.isMounted {
+	if journal.IsMounted() {
 		tags, err := journal.Tags()
 		if err != nil {
 			log.Println(err)
 		}
-		slices.Sort(tags)
 		state.tags = tags
+		state.sort()
 	} else {
-		state.tags = []string{}
+		state.tags = []TagInfo{}
+		state.tagTree = []*c.TreeNode[TagInfo]{}
+	}
+}
+
+func (state *TagsState) sort() {
+	slices.SortStableFunc(state.tags, func(a, b TagInfo) int {
+		switch state.sortMode {
+		case SortByCount:
+			if a.Count != b.Count {
+				return b.Count - a.Count
+			}
+		case SortByRecency:
+			if !a.LastUsed.Equal(b.LastUsed) {
+				return b.LastUsed.Compare(a.LastUsed)
+			}
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	// parents always exist, since the tags include the parents of nested tags
+	nodes := map[string]*c.TreeNode[TagInfo]{}
+	state.tagTree = []*c.TreeNode[TagInfo]{}
+	for _, tag := range state.tags {
+		nodes[tag.Name] = &c.TreeNode[TagInfo]{Item: tag}
 	}
+	for _, tag := range state.tags {
+		parent, isNested := nodes[tagParent(tag.Name)]
+		if isNested {
+			parent.Children = append(parent.Children, nodes[tag.Name])
+		} else {
+			state.tagTree = append(state.tagTree, nodes[tag.Name])
+		}
+	}
+}
+
+func (state *TagsState) cycleSort(offset int) {
+	state.sortMode = (state.sortMode + TagSort(offset) + numTagSorts) % numTagSorts
+	state.sort()
+}
+
+func (state *TagsState) showRefs(journal *Journal, tag string) {
+	refs, err := journal.SearchTag(tag)
+	if err != nil {
+		log.Print(err)
+	}
+	related, err := journal.RelatedTags(tag)
+	if err != nil {
+		log.Print(err)
+	}
+	state.isShowRefs = true
+	state.isRelatedFocus = false
+	state.refsTag = tag
+	state.narrowTag = ""
+	state.refs = refs
+	state.related = related
+	state.refList.Cursor, state.refList.VScroll = 0, 0
+	state.relatedList.Cursor, state.relatedList.VScroll = 0, 0
+}
+
+func (state *TagsState) narrowRefs(journal *Journal, tag string) {
+	if tag == state.narrowTag {
+		tag = ""
+	}
+	refs, err := journal.SearchTag(state.refsTag)
+	if err != nil {
+		log.Print(err)
+	}
+	if len(tag) > 0 {
+		others, err := journal.SearchTag(tag)
+		if err != nil {
+			log.Print(err)
+		}
+		refs = slices.DeleteFunc(refs, func(date time.Time) bool {
+			return !slices.ContainsFunc(others, date.Equal)
+		})
+	}
+	state.narrowTag = tag
+	state.refs = refs
+	state.refList.Cursor, state.refList.VScroll = 0, 0
+}
+
+func tagParent(tag string) string {
+	i := strings.LastIndex(tag, "/")
+	if i < 0 {
+		return ""
+	}
+	return tag[:i]
+}
+
+func tagLabel(tag string) string {
+	return tag[strings.LastIndex(tag, "/")+1:]
 }
 
 func TagsBrowser(r c.Renderer, props TagsProps) c.EventHandler {
@@ -45,38 +172,117 @@ func TagsBrowser(r c.Renderer, props TagsProps) c.EventHandler {
 
 	title := "[2]─Tags"
 	if state.isShowRefs {
-		title += " > References"
+		title += " > " + state.refsTag
+		if len(state.narrowTag) > 0 {
+			title += " & " + state.narrowTag
+		}
+	} else {
+		title += " (by " + tagSortNames[state.sortMode] + ")"
 	}
 
 	handler := c.Box(r, c.BoxProps{
-		Title:   title,
+		Title:   panelTitle(props.journal, title),
 		Borders: c.BordersRound,
 		Style:   theme.Borders(props.hasFocus),
 		Children: func(r c.Renderer) c.EventHandler {
 			if !state.isShowRefs {
-				return c.List(r, c.ListProps[string]{
+				width, height := r.Size()
+				filter := state.filter.Value
+
+				var filterHandler c.EventHandler
+				if state.isFiltering || len(filter) > 0 {
+					var filterRegion c.Renderer
+					r, filterRegion = r.SplitVertical(height - 1)
+					filterRegion.PutStrStyled(0, 0, "/", theme.Borders(props.hasFocus && state.isFiltering))
+					filterHandler = c.Input(filterRegion.SubRegion(c.NewRect(1, 0, width-1, 1)), c.InputProps{
+						State:      state.filter,
+						HideCursor: !props.hasFocus || !state.isFiltering,
+					})
+				}
+
+				// nested tags only show the last part of their name, unless filtered
+				label := func(tag TagInfo) string {
+					if len(filter) > 0 {
+						return tag.Name
+					}
+					return tagLabel(tag.Name)
+				}
+				indent := func(tag TagInfo) int {
+					if len(filter) > 0 {
+						return 0
+					}
+					return 2*strings.Count(tag.Name, "/") + 2
+				}
+				nameWidth := 0
+				for _, tag := range state.tags {
+					nameWidth = max(nameWidth, indent(tag)+utf8.RuneCountInString(label(tag)))
+				}
+				nameWidth = min(nameWidth, width-19)
+
+				treeHandler := c.Tree(r, c.TreeProps[TagInfo]{
 					State:        state.tagList,
-					Items:        state.tags,
+					Roots:        state.tagTree,
 					ShowSelected: props.hasFocus,
-					RenderFunc:   func(tag string) string { return tag },
-					OnEnter: func(i int, tag string) {
-						entries, err := props.journal.SearchTag(tag)
-						if err != nil {
-							log.Print(err)
-						}
-						state.refs = entries
-						state.refList.Cursor = 0
-						state.isShowRefs = true
-						if len(entries) > 0 {
-							props.onSelectRef(entries[0])
+					Filter:       filter,
+					FilterText:   func(tag TagInfo) string { return tag.Name },
+					Key:          func(tag TagInfo) string { return tag.Name },
+					RenderFunc: func(tag TagInfo) string {
+						name := utils.FixedString(label(tag), max(1, nameWidth-indent(tag)), " ")
+						return fmt.Sprintf("%s %4d  %s", name, tag.Count, tag.LastUsed.Format("02 Jan 2006"))
+					},
+					OnEnter: func(i int, tag TagInfo) {
+						state.showRefs(props.journal, tag.Name)
+						if len(state.refs) > 0 {
+							props.onSelectRef(state.refs[0])
 						}
 					},
 				})
+
+				return func(ev t.Event) bool {
+					key, isKey := ev.(*t.EventKey)
+					switch {
+					case !isKey:
+						return treeHandler(ev)
+
+					case state.isFiltering:
+						switch key.Key() {
+						case t.KeyEsc:
+							state.filter.Value, state.filter.Cursor = "", 0
+							state.isFiltering = false
+							return true
+						case t.KeyEnter:
+							state.isFiltering = false
+							return true
+						case t.KeyUp, t.KeyDown:
+							return treeHandler(ev)
+						}
+						return filterHandler(ev)
+
+					case key.Key() == t.KeyRune && key.Rune() == '/':
+						state.isFiltering = true
+						return true
+
+					case key.Key() == t.KeyEsc && len(filter) > 0:
+						state.filter.Value, state.filter.Cursor = "", 0
+						return true
+					}
+					return treeHandler(ev)
+				}
 			} else {
-				return c.List(r, c.ListProps[time.Time]{
+				// the references are on the left, and the related tags on the right
+				_, height := r.Size()
+				refsRegion, relatedRegion := r.SplitHorizontal(13)
+				for y := range height {
+					relatedRegion.PutStrStyled(0, y, "│", theme.Borders(props.hasFocus))
+				}
+				relatedWidth, _ := relatedRegion.Size()
+				headerRegion, relatedRegion := relatedRegion.SubRegion(c.NewRect(2, 0, relatedWidth-2, height)).SplitVertical(1)
+				headerRegion.PutStrStyled(0, 0, "Related tags", theme.Help())
+
+				refsHandler := c.List(refsRegion, c.ListProps[time.Time]{
 					State:        state.refList,
 					Items:        state.refs,
-					ShowSelected: props.hasFocus,
+					ShowSelected: props.hasFocus && !state.isRelatedFocus,
 					RenderFunc: func(item time.Time) string {
 						return item.Format("02 Jan 2006")
 					},
@@ -84,13 +290,63 @@ func TagsBrowser(r c.Renderer, props TagsProps) c.EventHandler {
 						props.onSelectRef(item)
 					},
 					OnEnter: func(i int, item time.Time) {
-						err := props.journal.EditEntry(item, false)
-						if err != nil {
-							log.Print(err)
-						}
+						props.onEdit(item, false)
 						state.isShowRefs = false
 					},
 				})
+
+				nameWidth := 0
+				for _, tag := range state.related {
+					nameWidth = max(nameWidth, utf8.RuneCountInString(tag.Name))
+				}
+				relatedHandler := c.List(relatedRegion, c.ListProps[TagInfo]{
+					State:        state.relatedList,
+					Items:        state.related,
+					ShowSelected: props.hasFocus && state.isRelatedFocus,
+					RenderFunc: func(tag TagInfo) string {
+						marker := "  "
+						if tag.Name == state.narrowTag {
+							marker = "● "
+						}
+						return fmt.Sprintf("%s%s %4d", marker, utils.FixedString(tag.Name, nameWidth, " "), tag.Count)
+					},
+					OnEnter: func(i int, tag TagInfo) {
+						state.narrowRefs(props.journal, tag.Name)
+						if len(state.refs) > 0 {
+							props.onSelectRef(state.refs[0])
+						}
+					},
+				})
+
+				return c.HandleKey(func(ev *t.EventKey) bool {
+					isRune := ev.Key() == t.KeyRune
+					if state.isRelatedFocus {
+						switch {
+						case ev.Key() == t.KeyLeft || isRune && ev.Rune() == 'h':
+							state.isRelatedFocus = false
+							return true
+						case ev.Key() == t.KeyEsc:
+							state.isRelatedFocus = false
+							if len(state.narrowTag) > 0 {
+								state.narrowRefs(props.journal, "")
+							}
+							return true
+						}
+						return relatedHandler(ev)
+					}
+
+					switch {
+					case ev.Key() == t.KeyRight || isRune && ev.Rune() == 'l':
+						if len(state.related) > 0 {
+							state.isRelatedFocus = true
+						}
+						return true
+					case ev.Key() == t.KeyEsc && len(state.narrowTag) > 0:
+						state.narrowRefs(props.journal, "")
+						return true
+					}
+					return refsHandler(ev)
+				})
 			}
 		},
 	})
@@ -112,8 +368,124 @@ func TagsBrowser(r c.Renderer, props TagsProps) c.EventHandler {
 			case 'r':
 				state.update(props.journal)
 				return true
+			case 's':
+				if !state.isShowRefs {
+					state.cycleSort(1)
+					return true
+				}
+			case 'S':
+				if !state.isShowRefs {
+					state.cycleSort(-1)
+					return true
+				}
+			case 'R':
+				if state.isShowRefs || len(state.tagList.Selected) == 0 {
+					return false
+				}
+				if props.journal.IsReadOnly() {
+					log.Println("cannot rename tag,", ErrReadOnly)
+					return true
+				}
+				tag := state.tagList.Selected
+				state.rename = &TagRenameState{
+					from:       tag,
+					input:      &c.InputState{Value: tag, Cursor: len(tag)},
+					showPrompt: true,
+				}
+				return true
 			}
 			return false
 		}),
 	)
 }
+
+func TagRenameDialog(r c.Renderer, props TagsProps) c.EventHandler {
+	state := props.state.rename
+	closeDialog := func() {
+		props.state.rename = &TagRenameState{input: &c.InputState{}}
+	}
+
+	if state.showConfirm {
+		action, preposition := "Rename", "to"
+		if existing, _ := props.journal.SearchTag(state.to); len(existing) > 0 {
+			action, preposition = "Merge", "into"
+		}
+		message := fmt.Sprintf("%s %s %s %s in %d entries? %s", action, state.from, preposition, state.to, len(state.dates), formatDates(state.dates, 8))
+
+		return c.Confirm(c.CenteredRegion(r.GetScreen(), 50, 3), true, c.ConfirmProps{
+			Message: message,
+			Yes:     action,
+			No:      "Cancel",
+			Borders: c.BordersRound,
+			Style:   theme.Borders(true, theme.Dialog()),
+			Value:   state.confirmChoice,
+			OnSelect: func(value bool) {
+				state.confirmChoice = value
+			},
+			OnChoice: func(accepted bool) {
+				closeDialog()
+				if !accepted {
+					return
+				}
+				_, err := props.journal.RenameTag(state.from, state.to)
+				if err != nil {
+					log.Println("failed to rename tag; ", err)
+				}
+				props.state.update(props.journal)
+				props.state.tagList.Selected = state.to
+			},
+		})
+	}
+
+	region := c.CenteredRegion(r.GetScreen(), 40, 3)
+	region.Fill(' ', theme.Dialog())
+	inputHandler := c.Box(region, c.BoxProps{
+		Title:   "Rename " + state.from + " to",
+		Borders: c.BordersRound,
+		Style:   theme.BordersFocus(),
+		Children: func(r c.Renderer) c.EventHandler {
+			return c.Input(r, c.InputProps{State: state.input})
+		},
+	})
+
+	return func(ev t.Event) bool {
+		if ev, isKey := ev.(*t.EventKey); isKey {
+			switch ev.Key() {
+			case t.KeyEsc:
+				closeDialog()
+				return true
+			case t.KeyEnter:
+				to := strings.TrimSpace(state.input.Value)
+				switch {
+				case to == state.from:
+					closeDialog()
+				case tagPattern.FindString(to) != to:
+					log.Printf("cannot rename tag, %q is not a valid tag", to)
+				default:
+					dates, err := props.journal.SearchTag(state.from)
+					if err != nil {
+						log.Println(err)
+					}
+					state.to = to
+					state.dates = dates
+					state.showPrompt = false
+					state.showConfirm = true
+				}
+				return true
+			}
+		}
+		return inputHandler(ev)
+	}
+}
+
+func formatDates(dates []time.Time, limit int) string {
+	parts := []string{}
+	for i, date := range dates {
+		if i == limit {
+			parts = append(parts, fmt.Sprintf("and %d more", len(dates)-limit))
+			break
+		}
+		parts = append(parts, date.Format("02 Jan 2006"))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	c "github.com/mecha/journal/components"
+)
+
+func tagNames(nodes []*c.TreeNode[TagInfo]) []string {
+	names := []string{}
+	for _, node := range nodes {
+		names = append(names, node.Item.Name)
+	}
+	return names
+}
+
+func TestTagsSort(t *testing.T) {
+	tags := []TagInfo{
+		{"@art", 1, day(2025, 1, 5)},
+		{"@gym", 5, day(2025, 1, 2)},
+		{"@read", 1, day(2025, 1, 5)},
+		{"@work", 3, day(2025, 1, 3)},
+		{"@work/a", 1, day(2025, 1, 3)},
+		{"@work/b", 2, day(2025, 1, 1)},
+	}
+
+	tests := []struct {
+		mode     TagSort
+		roots    []string
+		children []string
+	}{
+		{SortByName, []string{"@art", "@gym", "@read", "@work"}, []string{"@work/a", "@work/b"}},
+		// ties are sorted by name
+		{SortByCount, []string{"@gym", "@work", "@art", "@read"}, []string{"@work/b", "@work/a"}},
+		{SortByRecency, []string{"@art", "@read", "@work", "@gym"}, []string{"@work/a", "@work/b"}},
+	}
+	for _, test := range tests {
+		state := TagsState{tags: slices.Clone(tags), sortMode: test.mode}
+		state.sort()
+
+		roots := tagNames(state.tagTree)
+		if !slices.Equal(roots, test.roots) {
+			t.Errorf("sorted by %s: roots = %v, want %v", tagSortNames[test.mode], roots, test.roots)
+			continue
+		}
+		work := state.tagTree[slices.Index(roots, "@work")]
+		if children := tagNames(work.Children); !slices.Equal(children, test.children) {
+			t.Errorf("sorted by %s: children = %v, want %v", tagSortNames[test.mode], children, test.children)
+		}
+	}
+}
+
+func TestTagsCycleSort(t *testing.T) {
+	state := TagsState{tags: []TagInfo{
+		{"@a", 1, day(2025, 1, 2)},
+		{"@b", 2, day(2025, 1, 1)},
+	}}
+
+	steps := []struct {
+		offset int
+		mode   TagSort
+		roots  []string
+	}{
+		{1, SortByCount, []string{"@b", "@a"}},
+		{1, SortByRecency, []string{"@a", "@b"}},
+		{1, SortByName, []string{"@a", "@b"}},
+		{-1, SortByRecency, []string{"@a", "@b"}},
+		{-1, SortByCount, []string{"@b", "@a"}},
+	}
+	for i, step := range steps {
+		state.cycleSort(step.offset)
+		if roots := tagNames(state.tagTree); state.sortMode != step.mode || !slices.Equal(roots, step.roots) {
+			t.Errorf("step %d: sort mode = %v with %v, want %v with %v", i, state.sortMode, roots, step.mode, step.roots)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	c "github.com/mecha/journal/components"
+	"github.com/mecha/journal/theme"
+
+	t "github.com/gdamore/tcell/v2"
+)
+
+// Templates are kept inside the journal, so that they are encrypted too.
+const templatesDir = ".templates"
+
+var openTodoPattern = regexp.MustCompile(`^\s*[-*+] \[ \] (.*)$`)
+
+type TemplateData struct {
+	Date time.Time
+	// e.g. "Mon - 02 Jan 2006"
+	Title   string
+	Weekday string
+	// ISO week number
+	Week int
+	// open todos in the last entry before this one
+	Todos []string
+}
+
+func (j *Journal) Templates(date time.Time) ([]string, error) {
+	if !j.IsMounted() {
+		return []string{}, nil
+	}
+
+	paths, err := j.store.List()
+	if err != nil {
+		return []string{}, err
+	}
+
+	general, weekday := []string{}, []string{}
+	today := strings.ToLower(date.Weekday().String())
+	for _, path := range paths {
+		name, isTemplate := strings.CutPrefix(path, templatesDir+"/")
+		name, isMarkdown := strings.CutSuffix(name, ".md")
+		if !isTemplate || !isMarkdown || strings.Contains(name, "/") {
+			continue
+		}
+
+		day, _, _ := strings.Cut(name, "-")
+		switch {
+		case day == today:
+			weekday = append(weekday, name)
+		case !isWeekday(day):
+			general = append(general, name)
+		}
+	}
+
+	if len(weekday) > 0 {
+		general = weekday
+	}
+	slices.Sort(general)
+	return general, nil
+}
+
+func isWeekday(name string) bool {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if name == strings.ToLower(day.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *Journal) templateData(date time.Time) TemplateData {
+	_, week := date.ISOWeek()
+	data := TemplateData{
+		Date:    date,
+		Title:   date.Format("Mon - 02 Jan 2006"),
+		Weekday: date.Weekday().String(),
+		Week:    week,
+		Todos:   []string{},
+	}
+
+	entries, err := j.Entries()
+	if err != nil {
+		log.Println(err)
+	}
+	i, _ := slices.BinarySearchFunc(entries, date, func(a, b time.Time) int { return a.Compare(b) })
+	if i == 0 {
+		return data
+	}
+
+	content, _, err := j.GetEntry(entries[i-1])
+	if err != nil {
+		log.Println(err)
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if match := openTodoPattern.FindStringSubmatch(line); match != nil {
+			data.Todos = append(data.Todos, match[1])
+		}
+	}
+	return data
+}
+
+func (j *Journal) renderTemplate(name string, date time.Time) (string, error) {
+	text, err := j.store.Read(templatesDir + "/" + name + ".md")
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New(name).Parse(string(text))
+	if err != nil {
+		return "", err
+	}
+
+	var content strings.Builder
+	err = tmpl.Execute(&content, j.templateData(date))
+	if err != nil {
+		return "", err
+	}
+	return content.String(), nil
+}
+
+type TemplatePickerProps struct {
+	state   *TemplatePickerState
+	onClose func()
+}
+
+type TemplatePickerState struct {
+	date      time.Time
+	templates []string
+	list      *c.ListState[string]
+	onPick    func(template string)
+}
+
+func TemplatePicker(r c.Renderer, props TemplatePickerProps) c.EventHandler {
+	state := props.state
+	_, screenHeight := r.GetScreen().Size()
+	region := c.CenteredRegion(r.GetScreen(), 40, min(len(state.templates)+2, screenHeight-4))
+	region.Fill(' ', theme.Dialog())
+
+	listHandler := c.Box(region, c.BoxProps{
+		Title:   fmt.Sprintf("Template for %s", state.date.Format("02 Jan 2006")),
+		Borders: c.BordersRound,
+		Style:   theme.Borders(true, theme.Dialog()),
+		Children: func(r c.Renderer) c.EventHandler {
+			return c.List(r, c.ListProps[string]{
+				State:        state.list,
+				Items:        state.templates,
+				ShowSelected: true,
+				RenderFunc:   func(name string) string { return name },
+				OnEnter: func(i int, name string) {
+					props.onClose()
+					state.onPick(name)
+				},
+			})
+		},
+	})
+
+	return func(ev t.Event) bool {
+		if ev, isKey := ev.(*t.EventKey); isKey && ev.Key() == t.KeyEsc {
+			props.onClose()
+			return true
+		}
+		listHandler(ev)
+		return true
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTemplates(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{
+		".templates/default.md":       "# {{.Title}}",
+		".templates/work.md":          "# work",
+		".templates/monday.md":        "# monday",
+		".templates/monday-review.md": "# review",
+		".templates/tuesday.md":       "# tuesday",
+		".templates/notes.txt":        "not a template",
+		".templates/old/default.md":   "not a template either",
+		"2025/01/06.md":               "# entry",
+		"templates/not-in-the-dir.md": "not a template",
+	}, false)
+
+	tests := []struct {
+		date time.Time
+		want []string
+	}{
+		{day(2025, 1, 6), []string{"monday", "monday-review"}},
+		{day(2025, 1, 7), []string{"tuesday"}},
+		{day(2025, 1, 8), []string{"default", "work"}},
+	}
+	for _, test := range tests {
+		templates, err := journal.Templates(test.date)
+		if err != nil || !slices.Equal(templates, test.want) {
+			t.Errorf("Templates(%s) = %v, %v, want %v", test.date.Weekday(), templates, err, test.want)
+		}
+	}
+}
+
+func TestTemplateData(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{
+		"2025/01/03.md": "# Fri\n\n- [ ] call mom\n  * [ ] fix bike\n- [x] done already\n+ [ ] read\n- [] not a todo",
+		"2025/01/05.md": "# Sun\n\n- [ ] plan the week",
+	}, false)
+
+	tests := []struct {
+		date  time.Time
+		todos []string
+	}{
+		// todos come from the last entry before the date, not only yesterday
+		{day(2025, 1, 4), []string{"call mom", "fix bike", "read"}},
+		{day(2025, 1, 5), []string{"call mom", "fix bike", "read"}},
+		{day(2025, 1, 9), []string{"plan the week"}},
+		{day(2025, 1, 1), []string{}},
+	}
+	for _, test := range tests {
+		data := journal.templateData(test.date)
+		if !slices.Equal(data.Todos, test.todos) {
+			t.Errorf("templateData(%s).Todos = %q, want %q", test.date.Format("2006-01-02"), data.Todos, test.todos)
+		}
+	}
+
+	data := journal.templateData(day(2025, 1, 6))
+	if data.Title != "Mon - 06 Jan 2025" || data.Weekday != "Monday" || data.Week != 2 {
+		t.Errorf("templateData() = %+v", data)
+	}
+}
+
+func TestNewEntryContent(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{
+		".templates/daily.md":    "# {{.Title}}, week {{.Week}}\n\n{{range .Todos}}- [ ] {{.}}\n{{end}}",
+		".templates/short.md":    "# {{.Weekday}}\n",
+		".templates/unclosed.md": "# {{.Nope",
+		"2025/01/05.md":          "- [ ] plan the week\n- [ ] rest",
+	}, false)
+	date := day(2025, 1, 6)
+
+	// the first template is used if none is given
+	content, err := journal.NewEntryContent(date, "")
+	want := "# Mon - 06 Jan 2025, week 2\n\n- [ ] plan the week\n- [ ] rest\n"
+	if err != nil || content != want {
+		t.Errorf("NewEntryContent() = %q, %v, want %q", content, err, want)
+	}
+
+	content, err = journal.NewEntryContent(date, "short")
+	if err != nil || content != "# Monday\n" {
+		t.Errorf("NewEntryContent(short) = %q, %v", content, err)
+	}
+
+	if _, err := journal.NewEntryContent(date, "unclosed"); err == nil {
+		t.Error("NewEntryContent() with a broken template did not fail")
+	}
+	if _, err := journal.NewEntryContent(date, "missing"); err == nil {
+		t.Error("NewEntryContent() with a missing template did not fail")
+	}
+
+	// without templates, entries start with a heading
+	empty := newTestJournal(t, map[string]string{}, false)
+	content, err = empty.NewEntryContent(date, "")
+	if err != nil || content != "# Mon - 06 Jan 2025\n\n" {
+		t.Errorf("NewEntryContent() without templates = %q, %v", content, err)
+	}
+}
+
+func TestAppPickTemplate(t *testing.T) {
+	journal := newTestJournal(t, map[string]string{
+		".templates/a.md": "a",
+		".templates/b.md": "b",
+		"2025/01/06.md":   "# entry",
+	}, false)
+	app := CreateApp(journal, 0)
+	app.handleUnlock()
+
+	picked := []string{}
+	pick := func(template string) { picked = append(picked, template) }
+
+	// existing entries do not need a template
+	app.pickTemplate(day(2025, 1, 6), pick)
+	if app.templatePicker != nil || !slices.Equal(picked, []string{""}) {
+		t.Errorf("pickTemplate() for an existing entry = %v, picker %v", picked, app.templatePicker)
+	}
+
+	app.pickTemplate(day(2025, 1, 7), pick)
+	if app.templatePicker == nil || !slices.Equal(app.templatePicker.templates, []string{"a", "b"}) {
+		t.Fatalf("pickTemplate() did not ask which template to use: %+v", app.templatePicker)
+	}
+	app.templatePicker.onPick("b")
+	if !slices.Equal(picked, []string{"", "b"}) {
+		t.Errorf("picked %v", picked)
+	}
+
+}
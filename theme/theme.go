@@ -45,6 +45,18 @@ var (
 	Help = func(s ...t.Style) t.Style {
 		return extend(s).Foreground(t.ColorAqua)
 	}
+	Highlight = func(s ...t.Style) t.Style {
+		return extend(s).Bold(true).Foreground(t.ColorBlack).Background(t.ColorGold)
+	}
+	HelpWarning = func(s ...t.Style) t.Style {
+		return extend(s).Bold(true).Foreground(t.ColorOrangeRed)
+	}
+	DiffRemoved = func(s ...t.Style) t.Style {
+		return extend(s).Foreground(t.ColorBlack).Background(t.ColorIndianRed)
+	}
+	DiffAdded = func(s ...t.Style) t.Style {
+		return extend(s).Foreground(t.ColorBlack).Background(t.ColorDarkSeaGreen)
+	}
 )
 
 func extend(base []t.Style) t.Style {
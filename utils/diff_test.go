@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want []DiffLine
+	}{
+		{[]string{}, []string{}, []DiffLine{}},
+		{
+			[]string{"a", "b"},
+			[]string{"a", "b"},
+			[]DiffLine{{DiffSame, "a"}, {DiffSame, "b"}},
+		},
+		{
+			[]string{"a", "c"},
+			[]string{"a", "b", "c", "d"},
+			[]DiffLine{{DiffSame, "a"}, {DiffAdded, "b"}, {DiffSame, "c"}, {DiffAdded, "d"}},
+		},
+		{
+			[]string{"a", "b", "c"},
+			[]string{"c"},
+			[]DiffLine{{DiffRemoved, "a"}, {DiffRemoved, "b"}, {DiffSame, "c"}},
+		},
+		{
+			// removed lines come before the lines that replace them
+			[]string{"# title", "old", "end"},
+			[]string{"# title", "new", "end"},
+			[]DiffLine{{DiffSame, "# title"}, {DiffRemoved, "old"}, {DiffAdded, "new"}, {DiffSame, "end"}},
+		},
+	}
+	for _, test := range tests {
+		got := DiffLines(test.a, test.b)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("DiffLines(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
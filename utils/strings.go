@@ -44,6 +44,42 @@ func MaxLength(strings []string) int {
 	return maxLen
 }
 
+func IndexAllFold(s, substr string) []int {
+	indexes := []int{}
+	if len(substr) == 0 {
+		return indexes
+	}
+	for i := 0; i+len(substr) <= len(s); {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			indexes = append(indexes, i)
+			i += len(substr)
+		} else {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+		}
+	}
+	return indexes
+}
+
+func FuzzyMatch(text, pattern string) []int {
+	pattern = strings.ToLower(strings.Join(strings.Fields(pattern), ""))
+	needle := []rune(pattern)
+	positions := make([]int, 0, len(needle))
+	if len(needle) == 0 {
+		return positions
+	}
+
+	for i, r := range []rune(strings.ToLower(text)) {
+		if r == needle[len(positions)] {
+			positions = append(positions, i)
+			if len(positions) == len(needle) {
+				return positions
+			}
+		}
+	}
+	return nil
+}
+
 func WrapString(s string, n int) []string {
 	wrapped := wrap.Wrap(s, n)
 	lines := strings.Split(wrapped, "\n")
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIndexAllFold(t *testing.T) {
+	tests := []struct {
+		s, substr string
+		want      []int
+	}{
+		{"Daily standup, DAILY review", "daily", []int{0, 15}},
+		{"aaaa", "aa", []int{0, 2}},
+		{"no match here", "xyz", []int{}},
+		{"anything", "", []int{}},
+		{"short", "longer than s", []int{}},
+		{"café Café", "CAFÉ", []int{0, 6}},
+		{"über Über", "über", []int{0, 6}},
+	}
+	for _, test := range tests {
+		got := IndexAllFold(test.s, test.substr)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("IndexAllFold(%q, %q) = %v, want %v", test.s, test.substr, got, test.want)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		text, pattern string
+		want          []int
+	}{
+		{"@work/projectx/standup", "wps", []int{1, 6, 15}},
+		{"@work/projectx/standup", "WPS", []int{1, 6, 15}},
+		{"@work/projectx/standup", "work stand", []int{1, 2, 3, 4, 15, 16, 17, 18, 19}},
+		{"@gym", "", []int{}},
+		{"@gym", "mg", nil},
+		{"@gym", "gymx", nil},
+		// positions are rune indexes, not byte offsets
+		{"@café/bar", "éb", []int{4, 6}},
+	}
+	for _, test := range tests {
+		got := FuzzyMatch(test.text, test.pattern)
+		if !slices.Equal(got, test.want) || (got == nil) != (test.want == nil) {
+			t.Errorf("FuzzyMatch(%q, %q) = %v, want %v", test.text, test.pattern, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const vaultConfigName = "journal.vault"
+const vaultFileExt = ".enc"
+
+const vaultVersion = 1
+
+var ErrNotAVault = errors.New("Directory is not a journal vault")
+var ErrVaultVersion = errors.New("Journal vault has a format that this version of the app does not support")
+
+// Files are named after keyed hashes of their paths, so that the directory
+// does not reveal the dates of the entries.
+type VaultStore struct {
+	dirPath   string
+	config    vaultConfig
+	aead      cipher.AEAD
+	nameKey   []byte
+	files     map[string]*vaultFile
+	mutex     sync.RWMutex
+	isMounted bool
+	onChange  func(ev StoreEvent)
+	onUnmount func()
+}
+
+var _ InitStore = (*VaultStore)(nil)
+var _ PasswordStore = (*VaultStore)(nil)
+var _ RecoveryStore = (*VaultStore)(nil)
+
+type vaultConfig struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Key     []byte `json:"key"`
+	Check   []byte `json:"check"`
+}
+
+type vaultFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewVaultStore(dirPath string) *VaultStore {
+	return &VaultStore{
+		dirPath: strings.TrimSuffix(dirPath, "/"),
+		files:   map[string]*vaultFile{},
+	}
+}
+
+func (s *VaultStore) Mount(password string) error {
+	if s.isMounted {
+		return errors.New("journal is already mounted")
+	}
+
+	err := s.readConfig()
+	if err != nil {
+		return err
+	}
+
+	masterKey, err := s.unwrapKey(password)
+	if err != nil {
+		return err
+	}
+	defer clear(masterKey)
+
+	return s.mountWithKey(masterKey)
+}
+
+func (s *VaultStore) MountMasterKey(masterKeyStr string) error {
+	if s.isMounted {
+		return errors.New("journal is already mounted")
+	}
+
+	err := s.readConfig()
+	if err != nil {
+		return err
+	}
+
+	masterKey, err := s.parseMasterKey(masterKeyStr)
+	if err != nil {
+		return err
+	}
+	defer clear(masterKey)
+
+	return s.mountWithKey(masterKey)
+}
+
+func (s *VaultStore) mountWithKey(masterKey []byte) error {
+	err := s.useKey(masterKey)
+	if err == nil {
+		err = s.loadFiles()
+	}
+	if err != nil {
+		s.lock()
+		return err
+	}
+
+	s.isMounted = true
+	return nil
+}
+
+func (s *VaultStore) IsInitialized() bool {
+	_, err := os.Stat(filepath.Join(s.dirPath, vaultConfigName))
+	return err == nil
+}
+
+func (s *VaultStore) Init(password string) (string, error) {
+	if s.IsInitialized() {
+		return "", errors.New("journal has already been set up")
+	}
+
+	err := os.MkdirAll(s.dirPath, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	masterKey := make([]byte, 32)
+	rand.Read(masterKey)
+	defer clear(masterKey)
+
+	s.config = vaultConfig{Version: vaultVersion, N: 1 << 16, R: 8, P: 1}
+	err = s.saveKey(masterKey, password)
+	if err != nil {
+		return "", err
+	}
+
+	return formatMasterKey(masterKey), nil
+}
+
+func (s *VaultStore) ChangePassword(oldPassword, newPassword string) error {
+	err := s.readConfig()
+	if err != nil {
+		return err
+	}
+
+	masterKey, err := s.unwrapKey(oldPassword)
+	if err != nil {
+		return err
+	}
+	defer clear(masterKey)
+
+	return s.saveKey(masterKey, newPassword)
+}
+
+func (s *VaultStore) ResetPassword(masterKeyStr, newPassword string) error {
+	err := s.readConfig()
+	if err != nil {
+		return err
+	}
+
+	masterKey, err := s.parseMasterKey(masterKeyStr)
+	if err != nil {
+		return err
+	}
+	defer clear(masterKey)
+
+	return s.saveKey(masterKey, newPassword)
+}
+
+func (s *VaultStore) parseMasterKey(masterKeyStr string) ([]byte, error) {
+	masterKeyStr, err := normalizeMasterKey(masterKeyStr)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, err := hex.DecodeString(strings.ReplaceAll(masterKeyStr, "-", ""))
+	if err != nil {
+		return nil, ErrInvalidMasterKey
+	}
+
+	check, err := keyCheck(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(check, s.config.Check) {
+		clear(masterKey)
+		return nil, ErrInvalidMasterKey
+	}
+
+	return masterKey, nil
+}
+
+func (s *VaultStore) readConfig() error {
+	configData, err := os.ReadFile(filepath.Join(s.dirPath, vaultConfigName))
+	if os.IsNotExist(err) {
+		return ErrNotInitialized
+	}
+	if err != nil {
+		return err
+	}
+
+	s.config = vaultConfig{}
+	if err := json.Unmarshal(configData, &s.config); err != nil {
+		return ErrNotAVault
+	}
+	if s.config.Version != vaultVersion {
+		return fmt.Errorf("%w: %d", ErrVaultVersion, s.config.Version)
+	}
+	if len(s.config.Key) == 0 || len(s.config.Check) == 0 {
+		return ErrNotAVault
+	}
+	return nil
+}
+
+func (s *VaultStore) unwrapKey(password string) ([]byte, error) {
+	aead, err := s.passwordCipher(password)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, err := openData(aead, s.config.Key, []byte(vaultConfigName))
+	if err != nil {
+		return nil, ErrIncorrectPassword
+	}
+	return masterKey, nil
+}
+
+func (s *VaultStore) saveKey(masterKey []byte, password string) error {
+	s.config.Salt = make([]byte, 32)
+	rand.Read(s.config.Salt)
+
+	aead, err := s.passwordCipher(password)
+	if err != nil {
+		return err
+	}
+	s.config.Key = sealData(aead, masterKey, []byte(vaultConfigName))
+	s.config.Check, err = keyCheck(masterKey)
+	if err != nil {
+		return err
+	}
+
+	configData, err := json.MarshalIndent(s.config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dirPath, vaultConfigName), configData, 0600)
+}
+
+func (s *VaultStore) passwordCipher(password string) (cipher.AEAD, error) {
+	c := s.config
+	key, err := scrypt.Key([]byte(password), c.Salt, c.N, c.R, c.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+
+	return newGCM(key)
+}
+
+func (s *VaultStore) useKey(masterKey []byte) error {
+	contentKey, err := hkdf.Key(sha256.New, masterKey, nil, "journal content", 32)
+	if err != nil {
+		return err
+	}
+	defer clear(contentKey)
+
+	s.nameKey, err = hkdf.Key(sha256.New, masterKey, nil, "journal names", 32)
+	if err != nil {
+		return err
+	}
+
+	s.aead, err = newGCM(contentKey)
+	return err
+}
+
+func (s *VaultStore) loadFiles() error {
+	dirEntries, err := os.ReadDir(s.dirPath)
+	if err != nil {
+		return err
+	}
+
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || !strings.HasSuffix(name, vaultFileExt) {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		encrypted, err := os.ReadFile(filepath.Join(s.dirPath, name))
+		if err != nil {
+			return err
+		}
+		plaintext, err := openData(s.aead, encrypted, []byte(name))
+		if err != nil {
+			log.Printf("failed to decrypt %s: %s", name, err)
+			continue
+		}
+
+		path, data, found := bytes.Cut(plaintext, []byte{0})
+		if !found {
+			log.Printf("invalid vault file: %s", name)
+			continue
+		}
+		s.files[string(path)] = &vaultFile{data: data, modTime: info.ModTime()}
+	}
+
+	return nil
+}
+
+func (s *VaultStore) lock() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, file := range s.files {
+		clear(file.data)
+	}
+	clear(s.nameKey)
+	s.files = map[string]*vaultFile{}
+	s.nameKey = nil
+	s.aead = nil
+}
+
+func (s *VaultStore) Unmount() error {
+	if !s.isMounted {
+		return nil
+	}
+
+	s.lock()
+	s.isMounted = false
+	if s.onUnmount != nil {
+		s.onUnmount()
+	}
+
+	return nil
+}
+
+func (s *VaultStore) IsMounted() bool {
+	return s.isMounted
+}
+
+func (s *VaultStore) List() ([]string, error) {
+	if !s.isMounted {
+		return []string{}, errors.New("journal is not mounted")
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	paths := []string{}
+	for path := range s.files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	return paths, nil
+}
+
+func (s *VaultStore) Read(path string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	file, has := s.files[path]
+	if !has {
+		return nil, &fs.PathError{Op: "read", Path: path, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(file.data), nil
+}
+
+func (s *VaultStore) Write(path string, data []byte) error {
+	if !s.isMounted {
+		return errors.New("journal is not mounted")
+	}
+
+	name := s.fileName(path)
+	plaintext := append([]byte(path+"\x00"), data...)
+	encrypted := sealData(s.aead, plaintext, []byte(name))
+	clear(plaintext)
+
+	err := writeFileAtomic(filepath.Join(s.dirPath, name), encrypted, 0600)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.files[path] = &vaultFile{data: bytes.Clone(data), modTime: time.Now()}
+	s.mutex.Unlock()
+
+	if s.onChange != nil {
+		s.onChange(StoreEvent{Path: path})
+	}
+	return nil
+}
+
+func (s *VaultStore) Delete(path string) error {
+	if !s.isMounted {
+		return errors.New("journal is not mounted")
+	}
+
+	err := os.Remove(filepath.Join(s.dirPath, s.fileName(path)))
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	delete(s.files, path)
+	s.mutex.Unlock()
+
+	if s.onChange != nil {
+		s.onChange(StoreEvent{Path: path, Removed: true})
+	}
+	return nil
+}
+
+func (s *VaultStore) Stat(path string) (fs.FileInfo, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	file, has := s.files[path]
+	if !has {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	return vaultFileInfo{name: filepath.Base(path), size: len(file.data), modTime: file.modTime}, nil
+}
+
+func (s *VaultStore) Watch(onChange func(ev StoreEvent)) {
+	s.onChange = onChange
+}
+
+func (s *VaultStore) OnUnmount(fn func()) {
+	s.onUnmount = fn
+}
+
+func (s *VaultStore) fileName(path string) string {
+	mac := hmac.New(sha256.New, s.nameKey)
+	mac.Write([]byte(path))
+	return hex.EncodeToString(mac.Sum(nil)[:16]) + vaultFileExt
+}
+
+// Lets a master key be checked without storing the key itself.
+func keyCheck(masterKey []byte) ([]byte, error) {
+	return hkdf.Key(sha256.New, masterKey, nil, "journal key check", 32)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealData(aead cipher.AEAD, plaintext, additionalData []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plaintext, additionalData)
+}
+
+func openData(aead cipher.AEAD, encrypted, additionalData []byte) ([]byte, error) {
+	nonceSize := aead.NonceSize()
+	if len(encrypted) < nonceSize {
+		return nil, errors.New("encrypted data is too short")
+	}
+	return aead.Open(nil, encrypted[:nonceSize], encrypted[nonceSize:], additionalData)
+}
+
+// The same format that gocryptfs uses for its master keys.
+func formatMasterKey(key []byte) string {
+	hexKey := hex.EncodeToString(key)
+	groups := []string{}
+	for i := 0; i < len(hexKey); i += 8 {
+		groups = append(groups, hexKey[i:min(i+8, len(hexKey))])
+	}
+	return strings.Join(groups, "-")
+}
+
+type vaultFileInfo struct {
+	name    string
+	size    int
+	modTime time.Time
+}
+
+func (i vaultFileInfo) Name() string       { return i.name }
+func (i vaultFileInfo) Size() int64        { return int64(i.size) }
+func (i vaultFileInfo) Mode() fs.FileMode  { return 0600 }
+func (i vaultFileInfo) ModTime() time.Time { return i.modTime }
+func (i vaultFileInfo) IsDir() bool        { return false }
+func (i vaultFileInfo) Sys() any           { return nil }
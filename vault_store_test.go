@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Creates a new vault in a temporary directory, protected by a password.
+// Returns the vault and its master key.
+func newTestVault(t *testing.T, password string) (*VaultStore, string) {
+	t.Helper()
+	vault := NewVaultStore(t.TempDir())
+	masterKey, err := vault.Init(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vault, masterKey
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	vault, _ := newTestVault(t, "secret")
+	if err := vault.Mount("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("# Wed - 15 Jan 2025\n\nsomething private")
+	if err := vault.Write("2025/01/15.md", content); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Unmount(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.Read("2025/01/15.md"); err == nil {
+		t.Error("Read() works after Unmount()")
+	}
+
+	// neither the contents nor the dates of the entries are stored in plain text
+	dirEntries, _ := os.ReadDir(vault.dirPath)
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		data, _ := os.ReadFile(filepath.Join(vault.dirPath, name))
+		if bytes.Contains(data, []byte("private")) || bytes.Contains(data, []byte("2025/01/15")) {
+			t.Errorf("%s contains the entry in plain text", name)
+		}
+		if bytes.Contains([]byte(name), []byte("2025")) {
+			t.Errorf("file name %s reveals the entry's date", name)
+		}
+	}
+
+	if err := vault.Mount("secret"); err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Unmount()
+
+	paths, _ := vault.List()
+	if len(paths) != 1 || paths[0] != "2025/01/15.md" {
+		t.Errorf("List() = %v", paths)
+	}
+	read, err := vault.Read("2025/01/15.md")
+	if err != nil || !bytes.Equal(read, content) {
+		t.Errorf("Read() = %q, %v", read, err)
+	}
+}
+
+func TestVaultWrongPassword(t *testing.T) {
+	vault, _ := newTestVault(t, "secret")
+
+	if err := vault.Mount("wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("Mount() error = %v, want %v", err, ErrIncorrectPassword)
+	}
+	if vault.IsMounted() {
+		t.Error("vault was mounted with the wrong password")
+	}
+}
+
+func TestVaultTamperedFile(t *testing.T) {
+	vault, _ := newTestVault(t, "secret")
+	vault.Mount("secret")
+	vault.Write("2025/01/15.md", []byte("original"))
+	name := vault.fileName("2025/01/15.md")
+	vault.Unmount()
+
+	path := filepath.Join(vault.dirPath, name)
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 1
+	os.WriteFile(path, data, 0600)
+
+	if err := vault.Mount("secret"); err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Unmount()
+	if _, err := vault.Read("2025/01/15.md"); err == nil {
+		t.Error("a tampered file was decrypted")
+	}
+}
+
+// Rewrites the vault's config file, e.g. to break it.
+func editVaultConfig(t *testing.T, vault *VaultStore, edit func(config *vaultConfig)) {
+	t.Helper()
+	path := filepath.Join(vault.dirPath, vaultConfigName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := vaultConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	edit(&config)
+	data, _ = json.Marshal(config)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVaultMasterKey(t *testing.T) {
+	vault, masterKey := newTestVault(t, "secret")
+
+	if err := vault.MountMasterKey(strings.ToUpper(masterKey)); err != nil {
+		t.Fatal(err)
+	}
+	vault.Write("2025/01/15.md", []byte("entry"))
+	vault.Unmount()
+
+	if err := vault.ResetPassword(masterKey, "new secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Mount("secret"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("Mount() with the old password error = %v", err)
+	}
+	if err := vault.Mount("new secret"); err != nil {
+		t.Fatal(err)
+	}
+	defer vault.Unmount()
+	if data, _ := vault.Read("2025/01/15.md"); string(data) != "entry" {
+		t.Errorf("Read() after resetting the password = %q", data)
+	}
+}
+
+func TestVaultWrongMasterKey(t *testing.T) {
+	vault, _ := newTestVault(t, "secret")
+	_, wrongKey := newTestVault(t, "secret")
+
+	for _, key := range []string{wrongKey, "not a key", ""} {
+		if err := vault.MountMasterKey(key); !errors.Is(err, ErrInvalidMasterKey) {
+			t.Errorf("MountMasterKey(%q) error = %v, want %v", key, err, ErrInvalidMasterKey)
+		}
+	}
+	if vault.IsMounted() {
+		t.Error("vault was mounted with the wrong master key")
+	}
+}
+
+func TestVaultUnknownVersion(t *testing.T) {
+	for _, version := range []int{0, vaultVersion + 1} {
+		vault, masterKey := newTestVault(t, "secret")
+		editVaultConfig(t, vault, func(config *vaultConfig) { config.Version = version })
+
+		if err := vault.Mount("secret"); !errors.Is(err, ErrVaultVersion) {
+			t.Errorf("Mount() of version %d error = %v, want %v", version, err, ErrVaultVersion)
+		}
+		if err := vault.MountMasterKey(masterKey); !errors.Is(err, ErrVaultVersion) {
+			t.Errorf("MountMasterKey() of version %d error = %v, want %v", version, err, ErrVaultVersion)
+		}
+	}
+}
+
+// Mounting never writes the config file, so that read-only journals stay as
+// they are.
+func TestVaultMountDoesNotWrite(t *testing.T) {
+	vault, masterKey := newTestVault(t, "secret")
+	path := filepath.Join(vault.dirPath, vaultConfigName)
+	before, _ := os.ReadFile(path)
+
+	if err := vault.Mount("secret"); err != nil {
+		t.Fatal(err)
+	}
+	vault.Unmount()
+	if err := vault.MountMasterKey(masterKey); err != nil {
+		t.Fatal(err)
+	}
+	vault.Unmount()
+
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Errorf("config changed from %s to %s", before, after)
+	}
+}
+
+func TestVaultMissingKey(t *testing.T) {
+	vault, _ := newTestVault(t, "secret")
+	editVaultConfig(t, vault, func(config *vaultConfig) { config.Check = nil })
+
+	if err := vault.Mount("secret"); !errors.Is(err, ErrNotAVault) {
+		t.Errorf("Mount() error = %v, want %v", err, ErrNotAVault)
+	}
+}
+
+func TestVaultEditsInline(tt *testing.T) {
+	vault, _ := newTestVault(tt, "secret")
+	journal := NewJournal(vault, false)
+	if err := journal.Mount("secret"); err != nil {
+		tt.Fatal(err)
+	}
+	defer journal.Unmount()
+
+	if err := journal.EditEntry(day(2025, 1, 15), ""); !errors.Is(err, ErrNoExternalEditor) {
+		tt.Errorf("EditEntry() error = %v, want %v", err, ErrNoExternalEditor)
+	}
+	if has, _ := journal.HasEntry(day(2025, 1, 15)); has {
+		tt.Error("EditEntry() created the entry without editing it")
+	}
+
+	app := CreateApp(journal, 0)
+	app.handleUnlock()
+	app.editEntry(day(2025, 1, 15), false)
+	if app.inlineEdit == nil {
+		tt.Error("editEntry() did not edit the entry inline")
+	}
+
+	journal.stageEdits = true
+	if !journal.CanEditExternally() {
+		tt.Error("CanEditExternally() = false after enabling staged edits")
+	}
+}